@@ -1,10 +1,7 @@
-// +build amd64
-
 package prores
 
 import (
 	"math/bits"
-	"unsafe"
 )
 
 type Bitstream struct {
@@ -22,10 +19,12 @@ func (bs *Bitstream) ReadSmallUnary(dest *int) bool {
 	if l := len(bs.Bytes) - pos; l == 0 {
 		return false
 	} else if l >= 8 {
-		// XXX: This is not portable.
-		*dest = bits.LeadingZeros64(bits.ReverseBytes64(*(*uint64)(unsafe.Pointer(&bs.Bytes[pos]))) << uint(bs.Offset&7))
-		bs.Offset += *dest + 1
-		return true
+		// If the terminating one isn't in the loaded bits, the number is too big for this shortcut.
+		if n := bits.LeadingZeros64(loadUint64BigEndian(bs.Bytes[pos:]) << uint(bs.Offset&7)); n < 64-bs.Offset&7 {
+			*dest = n
+			bs.Offset += n + 1
+			return true
+		}
 	}
 
 	buf := bs.Bytes[bs.Offset>>3:]
@@ -71,6 +70,10 @@ func (bs *Bitstream) ReadInt(bits int, dest *int) bool {
 		endBit := bitOffset + bits
 		shiftRight := uint(8-endBit&7) & 7
 		switch {
+		case endBit > 32:
+			_ = buf[4]
+			b0 := buf[0] & byte(0xff>>uint(bitOffset))
+			*dest = int((uint64(b0)<<32 | uint64(buf[1])<<24 | uint64(buf[2])<<16 | uint64(buf[3])<<8 | uint64(buf[4])) >> shiftRight)
 		case endBit > 24:
 			_ = buf[3]
 			b0 := buf[0] & byte(0xff>>uint(bitOffset))
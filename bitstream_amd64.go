@@ -0,0 +1,16 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package prores
+
+import (
+	"math/bits"
+	"unsafe"
+)
+
+// Loads the first 8 bytes of b as a big-endian integer. b must have a length of at least 8.
+func loadUint64BigEndian(b []byte) uint64 {
+	_ = b[7]
+	// amd64 supports unaligned loads, so this compiles to a single load and byte swap.
+	return bits.ReverseBytes64(*(*uint64)(unsafe.Pointer(&b[0])))
+}
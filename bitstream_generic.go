@@ -0,0 +1,13 @@
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package prores
+
+import (
+	"encoding/binary"
+)
+
+// Loads the first 8 bytes of b as a big-endian integer. b must have a length of at least 8.
+func loadUint64BigEndian(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
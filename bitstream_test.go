@@ -22,6 +22,23 @@ func TestBitstream_ReadSmallUnary(t *testing.T) {
 	assert.Equal(t, 7, n)
 
 	assert.False(t, bs.ReadSmallUnary(&n))
+
+	t.Run("Long", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes:  []byte{0x10, 0, 0, 0, 0, 0, 0, 0, 0x40},
+			Offset: 4,
+		}
+		assert.True(t, bs.ReadSmallUnary(&n))
+		assert.Equal(t, 61, n)
+		assert.Equal(t, 66, bs.Offset)
+	})
+
+	t.Run("Unterminated", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes: make([]byte, 8),
+		}
+		assert.False(t, bs.ReadSmallUnary(&n))
+	})
 }
 
 func TestBitstream_ReadInt(t *testing.T) {
@@ -35,6 +52,16 @@ func TestBitstream_ReadInt(t *testing.T) {
 
 	assert.True(t, bs.ReadInt(6, &n))
 	assert.Equal(t, 2, n)
+
+	t.Run("Unaligned32Bits", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes:  []byte{0x01, 0x23, 0x45, 0x67, 0x89},
+			Offset: 4,
+		}
+		assert.True(t, bs.ReadInt(32, &n))
+		assert.Equal(t, 0x12345678, n)
+		assert.Equal(t, 36, bs.Offset)
+	})
 }
 
 func TestBitstream_ReadBit(t *testing.T) {
@@ -60,3 +87,48 @@ func TestBitstream_ReadBit(t *testing.T) {
 	assert.True(t, bs.ReadBit(&v))
 	assert.False(t, v)
 }
+
+func TestLoadUint64BigEndian(t *testing.T) {
+	b := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}
+	assert.Equal(t, uint64(0x0102030405060708), loadUint64BigEndian(b))
+	assert.Equal(t, uint64(0x0203040506070809), loadUint64BigEndian(b[1:]))
+}
+
+func TestBitstreamWriter(t *testing.T) {
+	var w BitstreamWriter
+	w.WriteInt(4, 0x0a)
+	w.WriteBit(true)
+	w.WriteUnary(3)
+	assert.Equal(t, 9, w.Len())
+	w.WriteInt(24, 0x123456)
+	w.WriteUnary(40)
+	assert.Equal(t, 9+24+41, w.Len())
+	w.Align()
+	assert.Equal(t, 80, w.Len())
+	w.WriteInt(3, 5)
+
+	bs := &Bitstream{Bytes: w.Bytes()}
+	assert.Equal(t, 88, bs.RemainingBits())
+
+	var n int
+	var b bool
+	assert.True(t, bs.ReadInt(4, &n))
+	assert.Equal(t, 0x0a, n)
+	assert.True(t, bs.ReadBit(&b))
+	assert.True(t, b)
+	assert.True(t, bs.ReadSmallUnary(&n))
+	assert.Equal(t, 3, n)
+	assert.True(t, bs.ReadInt(24, &n))
+	assert.Equal(t, 0x123456, n)
+	assert.True(t, bs.ReadSmallUnary(&n))
+	assert.Equal(t, 40, n)
+	bs.Offset = 80
+	assert.True(t, bs.ReadInt(3, &n))
+	assert.Equal(t, 5, n)
+	assert.True(t, bs.ReadInt(5, &n))
+	assert.Equal(t, 0, n)
+
+	w.Reset()
+	assert.Equal(t, 0, w.Len())
+	assert.Empty(t, w.Bytes())
+}
@@ -0,0 +1,66 @@
+package prores
+
+// BitstreamWriter is the counterpart to Bitstream. Bits are written most significant first into a
+// buffer that grows as needed. The zero value is an empty writer ready to use.
+type BitstreamWriter struct {
+	bytes []byte
+
+	// Bits that haven't been appended to bytes yet. They're kept in the low n bits of acc.
+	acc uint64
+	n   uint
+}
+
+// Writes the low bits of v. bits must be no more than 32.
+func (w *BitstreamWriter) WriteInt(bits int, v int) {
+	if bits == 0 {
+		return
+	}
+	w.acc = w.acc<<uint(bits) | uint64(v)&(1<<uint(bits)-1)
+	w.n += uint(bits)
+	for w.n >= 8 {
+		w.n -= 8
+		w.bytes = append(w.bytes, byte(w.acc>>w.n))
+	}
+}
+
+func (w *BitstreamWriter) WriteBit(v bool) {
+	if v {
+		w.WriteInt(1, 1)
+	} else {
+		w.WriteInt(1, 0)
+	}
+}
+
+// Writes n zeros followed by a one. This is read back by Bitstream.ReadSmallUnary.
+func (w *BitstreamWriter) WriteUnary(n int) {
+	for ; n >= 32; n -= 32 {
+		w.WriteInt(32, 0)
+	}
+	w.WriteInt(n+1, 1)
+}
+
+// Returns the number of bits written so far.
+func (w *BitstreamWriter) Len() int {
+	return len(w.bytes)<<3 + int(w.n)
+}
+
+// Pads the written bits with zeros to a byte boundary.
+func (w *BitstreamWriter) Align() {
+	if w.n > 0 {
+		w.WriteInt(int(8-w.n), 0)
+	}
+}
+
+// Aligns the written bits to a byte boundary and returns them. The returned slice is only valid
+// until the next call to Reset.
+func (w *BitstreamWriter) Bytes() []byte {
+	w.Align()
+	return w.bytes
+}
+
+// Discards all written bits, retaining the underlying buffer.
+func (w *BitstreamWriter) Reset() {
+	w.bytes = w.bytes[:0]
+	w.acc = 0
+	w.n = 0
+}
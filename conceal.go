@@ -0,0 +1,276 @@
+package prores
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// A ConcealmentMethod determines how slices that can't be decoded are filled in. See ConcealErrors.
+type ConcealmentMethod int
+
+const (
+	// Fills damaged slices with mid-gray. Their alpha is filled with full opacity.
+	ConcealGray ConcealmentMethod = iota
+
+	// Copies the samples of the slice directly above each damaged slice. Damaged slices in the top
+	// row are filled with gray.
+	ConcealCopyAbove
+
+	// Copies the samples of each damaged slice from a previously decoded frame.
+	ConcealPreviousFrame
+)
+
+// Concealment configures ConcealErrors.
+type Concealment struct {
+	Method ConcealmentMethod
+
+	// The frame that ConcealPreviousFrame copies from. It should be the previous frame of the same
+	// stream, decoded with the same options so that its type and bounds match the output. It can't
+	// share pixels with the image being decoded into, because damaged slices may be partially
+	// written before their errors are detected.
+	PreviousFrame image.Image
+
+	// If not nil, the report is reset when a frame is decoded and the damaged slices are recorded in
+	// it.
+	Report *ConcealmentReport
+}
+
+// A DamagedSlice is a slice that couldn't be decoded.
+type DamagedSlice struct {
+	// The picture that the slice belongs to. This is 0 for progressive frames and for the first
+	// field of interlaced frames, and 1 for the second field.
+	Picture int
+
+	// The index of the slice within the picture.
+	Index int
+
+	// The area covered by the slice, in full-size luma coordinates of its picture.
+	Rect image.Rectangle
+
+	// Why the slice couldn't be decoded.
+	Err error
+}
+
+// A ConcealmentReport lists the slices that were concealed while decoding a frame.
+type ConcealmentReport struct {
+	DamagedSlices []DamagedSlice
+}
+
+// ConcealErrors causes slices that can't be decoded to be concealed instead of failing the whole
+// frame. Errors in the frame or picture headers still fail the frame. Without this option, the first
+// damaged slice causes an error to be returned.
+func ConcealErrors(c Concealment) DecodeOption {
+	return func(o *decodeOptions) {
+		o.concealment = &c
+	}
+}
+
+// Prepares to conceal damaged slices if the options enable it. Returns the writers for the previous
+// frame if it's needed.
+func (p *pictureDecode) beginConcealment(writers *sliceWriters, options *decodeOptions) (sliceWriters, error) {
+	p.concealment = options.concealment
+	if p.concealment == nil {
+		return sliceWriters{}, nil
+	}
+	if report := p.concealment.Report; report != nil {
+		report.DamagedSlices = report.DamagedSlices[:0]
+	}
+	if p.concealment.Method != ConcealPreviousFrame {
+		return sliceWriters{}, nil
+	}
+
+	if p.concealment.PreviousFrame == nil {
+		return sliceWriters{}, fmt.Errorf("no previous frame to conceal errors with")
+	}
+	previous, err := newSliceWriters(p.concealment.PreviousFrame)
+	if err != nil {
+		return sliceWriters{}, err
+	}
+	if !previous.compatible(writers) {
+		return sliceWriters{}, fmt.Errorf("previous frame of type %T doesn't match the decoded frame", p.concealment.PreviousFrame)
+	}
+	if previous.luma.overlaps(&writers.luma) {
+		return sliceWriters{}, fmt.Errorf("previous frame shares pixels with the decoded frame")
+	}
+	previous.setScaleShift(options.scaleShift)
+	return previous, nil
+}
+
+func (p *pictureDecode) endConcealment() {
+	p.concealment = nil
+	p.previous = sliceWriters{}
+}
+
+// Records a slice that couldn't be decoded. If concealment isn't enabled, the picture fails instead.
+func (p *pictureDecode) damage(job *decodeSliceJob, rect image.Rectangle, err error) {
+	if p.concealment == nil {
+		p.fail(err)
+		return
+	}
+	p.errMu.Lock()
+	p.damaged = append(p.damaged, DamagedSlice{
+		Picture: p.index,
+		Index:   job.index,
+		Rect:    rect,
+		Err:     err,
+	})
+	p.errMu.Unlock()
+}
+
+// Conceals the damaged slices once every slice of the picture has been decoded. They're concealed
+// from top to bottom so that copies from above can cascade.
+func (p *pictureDecode) conceal(writers *sliceWriters) {
+	if len(p.damaged) == 0 {
+		return
+	}
+	sort.Slice(p.damaged, func(i, j int) bool {
+		return p.damaged[i].Index < p.damaged[j].Index
+	})
+	for _, slice := range p.damaged {
+		writers.conceal(slice.Rect, p.concealment.Method, &p.previous, p.sliceHeight)
+	}
+	if report := p.concealment.Report; report != nil {
+		report.DamagedSlices = append(report.DamagedSlices, p.damaged...)
+	}
+	p.damaged = p.damaged[:0]
+}
+
+// Returns whether w and other write the same kinds of samples.
+func (w *sliceWriters) compatible(other *sliceWriters) bool {
+	return (w.luma.pix8 == nil) == (other.luma.pix8 == nil) &&
+		w.luma.bitDepth == other.luma.bitDepth &&
+		w.chromaU.xShift == other.chromaU.xShift &&
+		w.hasAlpha == other.hasAlpha
+}
+
+// Conceals the given area of every plane.
+func (w *sliceWriters) conceal(rect image.Rectangle, method ConcealmentMethod, previous *sliceWriters, sliceHeight int) {
+	planes := [...]struct {
+		dst, previous *plane
+		alpha         bool
+	}{
+		{&w.luma, &previous.luma, false},
+		{&w.chromaU, &previous.chromaU, false},
+		{&w.chromaV, &previous.chromaV, false},
+		{&w.alpha, &previous.alpha, true},
+	}
+	for _, p := range planes {
+		if p.alpha && !w.hasAlpha {
+			continue
+		}
+		switch method {
+		case ConcealCopyAbove:
+			p.dst.copyAbove(rect, sliceHeight, p.alpha)
+		case ConcealPreviousFrame:
+			p.dst.copyFrom(p.previous, rect, p.alpha)
+		default:
+			p.dst.fill(rect, p.alpha)
+		}
+	}
+}
+
+// Returns whether the samples of p and other are in the same array.
+func (p *plane) overlaps(other *plane) bool {
+	if p.pix8 != nil && other.pix8 != nil {
+		a, b := p.pix8[:cap(p.pix8)], other.pix8[:cap(other.pix8)]
+		return len(a) > 0 && len(b) > 0 && &a[len(a)-1] == &b[len(b)-1]
+	}
+	if p.pix16 != nil && other.pix16 != nil {
+		a, b := p.pix16[:cap(p.pix16)], other.pix16[:cap(other.pix16)]
+		return len(a) > 0 && len(b) > 0 && &a[len(a)-1] == &b[len(b)-1]
+	}
+	return false
+}
+
+// Clips an area given in luma coordinates to the plane. See clip.
+func (p *plane) clipRect(r image.Rectangle) (offset, areaX, areaY, columns, rows int) {
+	width := (r.Max.X+1<<p.xShift-1)>>p.xShift - r.Min.X>>p.xShift
+	return p.clip(r.Min.X, r.Min.Y, width, r.Dy())
+}
+
+// Fills rows of the plane with gray, or with full opacity if the plane is an alpha channel.
+func (p *plane) fillRows(offset, columns, rows int, alpha bool) {
+	for row := 0; row < rows; row++ {
+		if p.pix8 != nil {
+			value := uint8(128)
+			if alpha {
+				value = 255
+			}
+			dest := p.pix8[offset+row*p.stride:][:columns]
+			for i := range dest {
+				dest[i] = value
+			}
+		} else {
+			value := uint16(1) << uint(p.bitDepth-1)
+			if alpha {
+				value = 1<<uint(p.bitDepth) - 1
+			}
+			dest := p.pix16[offset+row*p.stride:][:columns]
+			for i := range dest {
+				dest[i] = value
+			}
+		}
+	}
+}
+
+// Fills the given area with gray, or with full opacity if the plane is an alpha channel.
+func (p *plane) fill(r image.Rectangle, alpha bool) {
+	offset, _, _, columns, rows := p.clipRect(r)
+	p.fillRows(offset, columns, rows, alpha)
+}
+
+// Copies the samples that are distance rows above the given area into it. Rows with nothing above
+// them are filled like fill does.
+func (p *plane) copyAbove(r image.Rectangle, distance int, alpha bool) {
+	offset, _, _, columns, rows := p.clipRect(r)
+	if rows == 0 {
+		return
+	}
+	distance >>= p.scaleShift
+	for row := 0; row < rows; row++ {
+		dest := offset + row*p.stride
+		src := dest - distance*p.stride
+		switch {
+		case src < 0:
+			p.fillRows(dest, columns, 1, alpha)
+		case p.pix8 != nil:
+			copy(p.pix8[dest:][:columns], p.pix8[src:][:columns])
+		default:
+			copy(p.pix16[dest:][:columns], p.pix16[src:][:columns])
+		}
+	}
+}
+
+// Copies the given area from the same area of src. Any part of the area that src doesn't cover is
+// filled like fill does.
+func (p *plane) copyFrom(src *plane, r image.Rectangle, alpha bool) {
+	offset, areaX, areaY, columns, rows := p.clipRect(r)
+	if rows == 0 {
+		return
+	}
+
+	// Find the part of the area that's in both planes.
+	srcOffset, srcAreaX, srcAreaY, srcColumns, srcRows := src.clipRect(r)
+	x0, x1 := max(areaX, srcAreaX), min(areaX+columns, srcAreaX+srcColumns)
+	y0, y1 := max(areaY, srcAreaY), min(areaY+rows, srcAreaY+srcRows)
+	if srcRows == 0 || x0 >= x1 {
+		y0, y1 = 0, 0
+	}
+
+	for y := areaY; y < areaY+rows; y++ {
+		dest := offset + (y-areaY)*p.stride
+		if y < y0 || y >= y1 {
+			p.fillRows(dest, columns, 1, alpha)
+			continue
+		}
+		from := srcOffset + (y-srcAreaY)*src.stride + x0 - srcAreaX
+		p.fillRows(dest, x0-areaX, 1, alpha)
+		if p.pix8 != nil {
+			copy(p.pix8[dest+x0-areaX:][:x1-x0], src.pix8[from:][:x1-x0])
+		} else {
+			copy(p.pix16[dest+x0-areaX:][:x1-x0], src.pix16[from:][:x1-x0])
+		}
+		p.fillRows(dest+x1-areaX, areaX+columns-x1, 1, alpha)
+	}
+}
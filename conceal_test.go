@@ -0,0 +1,139 @@
+package prores
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns the offset and size of each slice of the first picture in frame.
+func sliceSpans(t testing.TB, frame []byte) (offsets, sizes []int) {
+	var frameHeader FrameHeader
+	require.NoError(t, frameHeader.Decode(bytes.NewReader(frame)))
+	picture := frame[frameHeader.HeaderSize:]
+	var pictureHeader PictureHeader
+	require.NoError(t, pictureHeader.Decode(bytes.NewReader(picture)))
+
+	indexTable := picture[pictureHeader.HeaderSize:]
+	offset := int(frameHeader.HeaderSize) + int(pictureHeader.HeaderSize) + 2*pictureHeader.NumberOfSlices
+	for i := 0; i < pictureHeader.NumberOfSlices; i++ {
+		size := int(binary.BigEndian.Uint16(indexTable[2*i:]))
+		offsets = append(offsets, offset)
+		sizes = append(sizes, size)
+		offset += size
+	}
+	return offsets, sizes
+}
+
+// Returns a copy of frame with the coefficients of the given slices replaced by garbage.
+func damageSlices(t *testing.T, frame []byte, slices ...int) []byte {
+	offsets, sizes := sliceSpans(t, frame)
+	damaged := append([]byte(nil), frame...)
+	for _, i := range slices {
+		headerSize := int(damaged[offsets[i]] >> 3)
+		for j := offsets[i] + headerSize; j < offsets[i]+sizes[i]; j++ {
+			damaged[j] = 0xff
+		}
+	}
+	return damaged
+}
+
+func TestConcealErrors(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	img, err := DecodeFrameBytes(buf)
+	require.NoError(t, err)
+	clean := img.(*image.YCbCr)
+
+	// The frame is 1920 pixels wide with 128 pixel wide slices, so slice 130 is below slice 115.
+	damaged := damageSlices(t, buf, 0, 130)
+	damagedRects := []image.Rectangle{image.Rect(0, 0, 128, 16), image.Rect(1280, 128, 1408, 144)}
+	inDamagedRect := func(x, y int) bool {
+		p := image.Pt(x, y)
+		return p.In(damagedRects[0]) || p.In(damagedRects[1])
+	}
+
+	t.Run("Strict", func(t *testing.T) {
+		img, err := DecodeFrameBytes(damaged)
+		assert.Nil(t, img)
+		assert.Error(t, err)
+	})
+
+	for name, tc := range map[string]struct {
+		Concealment Concealment
+		Expected    func(x, y int) color.YCbCr
+	}{
+		"Gray": {
+			Concealment: Concealment{Method: ConcealGray},
+			Expected: func(x, y int) color.YCbCr {
+				return color.YCbCr{128, 128, 128}
+			},
+		},
+		"CopyAbove": {
+			Concealment: Concealment{Method: ConcealCopyAbove},
+			Expected: func(x, y int) color.YCbCr {
+				if y < 16 {
+					return color.YCbCr{128, 128, 128}
+				}
+				return clean.YCbCrAt(x, y-16)
+			},
+		},
+		"PreviousFrame": {
+			Concealment: Concealment{Method: ConcealPreviousFrame, PreviousFrame: clean},
+			Expected:    clean.YCbCrAt,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var report ConcealmentReport
+			tc.Concealment.Report = &report
+			img, err := DecodeFrameBytes(damaged, ConcealErrors(tc.Concealment))
+			require.NoError(t, err)
+			concealed := img.(*image.YCbCr)
+
+			require.Len(t, report.DamagedSlices, 2)
+			for i, slice := range report.DamagedSlices {
+				assert.Equal(t, 0, slice.Picture)
+				assert.Equal(t, []int{0, 130}[i], slice.Index)
+				assert.Equal(t, damagedRects[i], slice.Rect)
+				assert.Error(t, slice.Err)
+			}
+
+			for y := 0; y < clean.Rect.Dy(); y++ {
+				for x := 0; x < clean.Rect.Dx(); x++ {
+					expected := clean.YCbCrAt(x, y)
+					if inDamagedRect(x, y) {
+						expected = tc.Expected(x, y)
+					}
+					require.Equal(t, expected, concealed.YCbCrAt(x, y), "x: %v, y: %v", x, y)
+				}
+			}
+
+			// The report is reset for each frame.
+			_, err = DecodeFrameBytes(buf, ConcealErrors(tc.Concealment))
+			require.NoError(t, err)
+			assert.Empty(t, report.DamagedSlices)
+		})
+	}
+
+	t.Run("InvalidPreviousFrame", func(t *testing.T) {
+		_, err := DecodeFrameBytes(damaged, ConcealErrors(Concealment{Method: ConcealPreviousFrame}))
+		assert.Error(t, err)
+
+		previous := NewYCbCr16(clean.Rect, clean.SubsampleRatio, 10)
+		_, err = DecodeFrameBytes(damaged, ConcealErrors(Concealment{Method: ConcealPreviousFrame, PreviousFrame: previous}))
+		assert.Error(t, err)
+
+		// Damaged slices may be partially written, so the previous frame can't be the destination.
+		dst := image.NewYCbCr(clean.Rect, clean.SubsampleRatio)
+		assert.Error(t, DecodeFrameInto(dst, bytes.NewReader(damaged), int64(len(damaged)), ConcealErrors(Concealment{
+			Method:        ConcealPreviousFrame,
+			PreviousFrame: dst.SubImage(image.Rect(0, 16, 128, 32)),
+		})))
+	})
+}
@@ -0,0 +1,100 @@
+package prores
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// In QuickTime movies, each frame is wrapped in an "icpf" box: a 4-byte size, which includes the
+// box's own header, followed by the box type.
+const (
+	frameContainerType       = "icpf"
+	frameContainerHeaderSize = 8
+)
+
+// TruncatedFrameError is returned when a frame's container declares more bytes than are available.
+type TruncatedFrameError struct {
+	DeclaredSize int64
+	Size         int64
+}
+
+func (e *TruncatedFrameError) Error() string {
+	return fmt.Sprintf("truncated frame: container declares %v bytes, but only %v are available", e.DeclaredSize, e.Size)
+}
+
+// Is makes TruncatedFrameError match ErrTruncated.
+func (e *TruncatedFrameError) Is(target error) bool {
+	return target == ErrTruncated
+}
+
+// OversizedFrameError is returned when a frame's container declares fewer bytes than were given.
+type OversizedFrameError struct {
+	DeclaredSize int64
+	Size         int64
+}
+
+func (e *OversizedFrameError) Error() string {
+	return fmt.Sprintf("oversized frame: container declares %v bytes, but %v were given", e.DeclaredSize, e.Size)
+}
+
+// Is makes OversizedFrameError match ErrInvalidHeader.
+func (e *OversizedFrameError) Is(target error) bool {
+	return target == ErrInvalidHeader
+}
+
+// FrameReader reads a frame's data, starting with its frame header. If the frame was wrapped in an
+// icpf container, the container's header is excluded.
+type FrameReader struct {
+	*io.SectionReader
+
+	// True if the frame was wrapped in an icpf container.
+	HasContainer bool
+}
+
+// Creates a FrameReader for the size bytes of r. If they begin with an icpf container, its declared
+// size must be exactly size. Otherwise a *TruncatedFrameError or *OversizedFrameError is returned.
+// Data without a container is assumed to begin with the frame header.
+func NewFrameReader(r io.ReaderAt, size int64) (*FrameReader, error) {
+	var buf [frameContainerHeaderSize]byte
+	offset, hasContainer, err := frameOffset(readerData(r, size), &buf)
+	if err != nil {
+		return nil, err
+	}
+	return &FrameReader{
+		SectionReader: io.NewSectionReader(r, offset, size-offset),
+		HasContainer:  hasContainer,
+	}, nil
+}
+
+// Returns the offset of the frame header within data, which is non-zero if it begins with an icpf
+// container. buf is used to read the container's header.
+func frameOffset(data encodedData, buf *[frameContainerHeaderSize]byte) (int64, bool, error) {
+	size := data.Size()
+	if size < frameContainerHeaderSize {
+		return 0, false, nil
+	}
+	header, err := data.bytes(0, frameContainerHeaderSize, buf[:])
+	if err != nil {
+		return 0, false, err
+	}
+	if string(header[4:]) != frameContainerType {
+		return 0, false, nil
+	}
+
+	declaredSize := int64(binary.BigEndian.Uint32(header))
+	if declaredSize < frameContainerHeaderSize {
+		return 0, false, fmt.Errorf("%w: frame container size %v", ErrInvalidHeader, declaredSize)
+	} else if declaredSize > size {
+		return 0, false, &TruncatedFrameError{
+			DeclaredSize: declaredSize,
+			Size:         size,
+		}
+	} else if declaredSize < size {
+		return 0, false, &OversizedFrameError{
+			DeclaredSize: declaredSize,
+			Size:         size,
+		}
+	}
+	return frameContainerHeaderSize, true, nil
+}
@@ -0,0 +1,72 @@
+package prores
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func wrapFrame(frame []byte, declaredSize int) []byte {
+	ret := make([]byte, 8, 8+len(frame))
+	binary.BigEndian.PutUint32(ret, uint32(declaredSize))
+	copy(ret[4:], "icpf")
+	return append(ret, frame...)
+}
+
+func TestNewFrameReader(t *testing.T) {
+	frame, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+
+	t.Run("Bare", func(t *testing.T) {
+		r, err := NewFrameReader(bytes.NewReader(frame), int64(len(frame)))
+		require.NoError(t, err)
+		assert.False(t, r.HasContainer)
+		assert.EqualValues(t, len(frame), r.Size())
+	})
+
+	t.Run("Container", func(t *testing.T) {
+		wrapped := wrapFrame(frame, len(frame)+8)
+		r, err := NewFrameReader(bytes.NewReader(wrapped), int64(len(wrapped)))
+		require.NoError(t, err)
+		assert.True(t, r.HasContainer)
+		contents, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, frame, contents)
+
+		expected, err := DecodeFrame(bytes.NewReader(frame), int64(len(frame)))
+		require.NoError(t, err)
+		actual, err := DecodeFrame(bytes.NewReader(wrapped), int64(len(wrapped)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		wrapped := wrapFrame(frame, len(frame)+9)
+		_, err := DecodeFrame(bytes.NewReader(wrapped), int64(len(wrapped)))
+		var truncated *TruncatedFrameError
+		require.True(t, errors.As(err, &truncated), "%v", err)
+		assert.EqualValues(t, len(frame)+9, truncated.DeclaredSize)
+		assert.EqualValues(t, len(frame)+8, truncated.Size)
+		assert.True(t, errors.Is(err, ErrTruncated))
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		wrapped := wrapFrame(frame, len(frame)+7)
+		_, err := NewFrameReader(bytes.NewReader(wrapped), int64(len(wrapped)))
+		var oversized *OversizedFrameError
+		require.True(t, errors.As(err, &oversized), "%v", err)
+		assert.EqualValues(t, len(frame)+7, oversized.DeclaredSize)
+		assert.True(t, errors.Is(err, ErrInvalidHeader))
+	})
+
+	t.Run("InvalidSize", func(t *testing.T) {
+		wrapped := wrapFrame(nil, 4)
+		_, err := NewFrameReader(bytes.NewReader(wrapped), int64(len(wrapped)))
+		assert.True(t, errors.Is(err, ErrInvalidHeader), "%v", err)
+	})
+}
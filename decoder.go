@@ -0,0 +1,174 @@
+package prores
+
+import (
+	"context"
+	"image"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// A DecoderOption configures a Decoder.
+type DecoderOption func(*decoderConfig)
+
+type decoderConfig struct {
+	workers        int
+	singleThreaded bool
+}
+
+// WorkerCount sets the number of goroutines that a Decoder decodes slices with. If n is zero or
+// negative, the default of one worker per GOMAXPROCS is used.
+func WorkerCount(n int) DecoderOption {
+	return func(c *decoderConfig) {
+		c.workers = n
+	}
+}
+
+// SingleThreaded causes a Decoder to decode every slice on the goroutine that decodes the frame
+// instead of using a pool of workers. This is useful when frames are already being decoded in
+// parallel.
+func SingleThreaded() DecoderOption {
+	return func(c *decoderConfig) {
+		c.singleThreaded = true
+	}
+}
+
+// A Decoder decodes frames using a pool of worker goroutines that lives as long as the Decoder,
+// along with the SliceDecoder used by each worker. This avoids starting new goroutines and
+// allocating new buffers for every frame. A Decoder is safe for concurrent use, and the slices of
+// concurrently decoded frames share its workers.
+//
+// The package-level decoding functions use a Decoder with the default configuration.
+type Decoder struct {
+	// nil if slices are decoded on the calling goroutine
+	jobs chan decodeSliceJob
+
+	// only used if slices are decoded on the calling goroutine
+	sliceDecoder *SliceDecoder
+
+	// *frameDecode values, whose buffers are reused from frame to frame
+	frames sync.Pool
+
+	closeOnce sync.Once
+}
+
+// Creates a Decoder and starts its workers. Close should be called once the Decoder is no longer
+// needed.
+func NewDecoder(opts ...DecoderOption) *Decoder {
+	var config decoderConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	d := &Decoder{}
+	if config.singleThreaded {
+		d.sliceDecoder = NewSliceDecoder()
+		return d
+	}
+
+	workers := config.workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	d.jobs = make(chan decodeSliceJob, workers)
+	for i := 0; i < workers; i++ {
+		go d.work(NewSliceDecoder())
+	}
+	return d
+}
+
+// The state needed to decode a frame.
+type frameDecode struct {
+	header       FrameHeader
+	headerBuf    [maxFrameHeaderSize]byte
+	containerBuf [frameContainerHeaderSize]byte
+
+	// The frame's pictures.
+	pictures encodedData
+
+	options decodeOptions
+	picture pictureDecode
+}
+
+func (d *Decoder) getFrameDecode() *frameDecode {
+	if f, ok := d.frames.Get().(*frameDecode); ok {
+		return f
+	}
+	return &frameDecode{}
+}
+
+func (d *Decoder) putFrameDecode(f *frameDecode) {
+	// Don't hang on to the caller's data.
+	f.pictures = encodedData{}
+	f.options = decodeOptions{}
+	d.frames.Put(f)
+}
+
+func (d *Decoder) work(decoder *SliceDecoder) {
+	for job := range d.jobs {
+		job.picture.decodeSlice(decoder, &job)
+		job.picture.wg.Done()
+	}
+}
+
+// Close stops the Decoder's workers. The Decoder must not be used afterwards.
+func (d *Decoder) Close() error {
+	d.closeOnce.Do(func() {
+		if d.jobs != nil {
+			close(d.jobs)
+		}
+	})
+	return nil
+}
+
+var defaultDecoderOnce sync.Once
+var defaultDecoderInstance *Decoder
+
+// Returns the Decoder used by the package-level decoding functions. It's created when it's first
+// needed and never closed.
+func defaultDecoder() *Decoder {
+	defaultDecoderOnce.Do(func() {
+		defaultDecoderInstance = NewDecoder()
+	})
+	return defaultDecoderInstance
+}
+
+// Like the package-level DecodeFrame, but decodes using d's workers.
+func (d *Decoder) DecodeFrame(r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return d.decodeFrame(context.Background(), readerData(r, size), false, opts)
+}
+
+// Like the package-level DecodeFrameContext, but decodes using d's workers.
+func (d *Decoder) DecodeFrameContext(ctx context.Context, r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return d.decodeFrame(ctx, readerData(r, size), false, opts)
+}
+
+// Like the package-level DecodeFrameInto, but decodes using d's workers.
+func (d *Decoder) DecodeFrameInto(dst image.Image, r io.ReaderAt, size int64, opts ...DecodeOption) error {
+	return d.decodeFrameInto(context.Background(), dst, readerData(r, size), opts)
+}
+
+// Like the package-level DecodeFrameBytes, but decodes using d's workers.
+func (d *Decoder) DecodeFrameBytes(b []byte, opts ...DecodeOption) (image.Image, error) {
+	return d.decodeFrame(context.Background(), bytesData(b), false, opts)
+}
+
+// Like the package-level DecodeFrameRegion, but decodes using d's workers.
+func (d *Decoder) DecodeFrameRegion(r io.ReaderAt, size int64, rect image.Rectangle, opts ...DecodeOption) (image.Image, error) {
+	return d.decodeFrameRegion(context.Background(), readerData(r, size), rect, opts)
+}
+
+// Like the package-level DecodeFrame16, but decodes using d's workers.
+func (d *Decoder) DecodeFrame16(r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return d.decodeFrame(context.Background(), readerData(r, size), true, opts)
+}
+
+// Like the package-level DecodePicture, but decodes using d's workers.
+func (d *Decoder) DecodePicture(r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder) (image.Image, error) {
+	return d.decodePicture(context.Background(), r, frameHeader, fieldOrder, false)
+}
+
+// Like the package-level DecodePicture16, but decodes using d's workers.
+func (d *Decoder) DecodePicture16(r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder) (image.Image, error) {
+	return d.decodePicture(context.Background(), r, frameHeader, fieldOrder, true)
+}
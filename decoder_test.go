@@ -0,0 +1,46 @@
+package prores
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/bir-atl-interlaced-frame.icpf")
+	require.NoError(t, err)
+
+	expected, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)), WeaveFields())
+	require.NoError(t, err)
+
+	for name, opts := range map[string][]DecoderOption{
+		"Default":        nil,
+		"OneWorker":      {WorkerCount(1)},
+		"ManyWorkers":    {WorkerCount(32)},
+		"SingleThreaded": {SingleThreaded()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			decoder := NewDecoder(opts...)
+			defer decoder.Close()
+
+			// The decoder should be reusable and safe for concurrent use.
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 2; j++ {
+						img, err := decoder.DecodeFrame(bytes.NewReader(buf), int64(len(buf)), WeaveFields())
+						assert.NoError(t, err)
+						assert.Equal(t, expected, img)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package prores
+
+import (
+	"io"
+	"math"
+)
+
+// encodedData is a range of encoded bytes that's either in memory or read from an io.ReaderAt. Data
+// in memory is sliced directly instead of being copied.
+type encodedData struct {
+	// If b is nil, the data is read from r, starting at offset.
+	r      io.ReaderAt
+	offset int64
+
+	b    []byte
+	size int64
+}
+
+func readerData(r io.ReaderAt, size int64) encodedData {
+	return encodedData{
+		r:    r,
+		size: size,
+	}
+}
+
+// Returns data that reads from r without knowing how much data r has. Reads past the end of r's data
+// fail however r fails them.
+func unboundedReaderData(r io.ReaderAt) encodedData {
+	return readerData(r, math.MaxInt64)
+}
+
+func bytesData(b []byte) encodedData {
+	return encodedData{
+		b:    b,
+		size: int64(len(b)),
+	}
+}
+
+func (d encodedData) Size() int64 {
+	return d.size
+}
+
+// Returns the data in the given range. Like io.NewSectionReader, the range is truncated to the data
+// that's available.
+func (d encodedData) section(offset, size int64) encodedData {
+	if offset < 0 || offset > d.size {
+		offset = d.size
+	}
+	if size < 0 || size > d.size-offset {
+		size = d.size - offset
+	}
+	if d.b != nil {
+		return bytesData(d.b[offset : offset+size])
+	}
+	return encodedData{
+		r:      d.r,
+		offset: d.offset + offset,
+		size:   size,
+	}
+}
+
+// Returns n bytes of the data starting at offset. If the data is in memory, it's returned directly.
+// Otherwise it's read into buf, which must have a length of at least n. If fewer than n bytes are
+// available, an error is returned.
+func (d encodedData) bytes(offset, n int64, buf []byte) ([]byte, error) {
+	if offset < 0 || n < 0 || offset > d.size || n > d.size-offset {
+		return nil, errUnexpectedEOF
+	}
+	if d.b != nil {
+		return d.b[offset : offset+n], nil
+	}
+	buf = buf[:n]
+	if read, err := d.r.ReadAt(buf, d.offset+offset); read < len(buf) {
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = errUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
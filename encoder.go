@@ -0,0 +1,472 @@
+package prores
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"sync"
+)
+
+// A Profile determines the chroma format and target data rate of encoded frames.
+type Profile int
+
+const (
+	ProfileProxy Profile = iota
+	ProfileLT
+	ProfileStandard
+	ProfileHQ
+	Profile4444
+	Profile4444XQ
+)
+
+// The number of macroblocks per frame that each entry of profileInfo.bitsPerMacroblock applies up to.
+// Larger frames use the last entry.
+var macroblockLimits = [...]int{
+	1620, // 720x576
+	2700, // 960x720
+	6075, // 1440x1080
+	9216, // 2048x1152
+}
+
+type profileInfo struct {
+	fourCC            string
+	name              string
+	minQuant          int
+	bitsPerMacroblock [len(macroblockLimits)]int
+	lumaMatrix        *[64]uint8
+	chromaMatrix      *[64]uint8
+}
+
+var proxyQuantizationMatrix = [64]uint8{
+	4, 7, 9, 11, 13, 14, 15, 63,
+	7, 7, 11, 12, 14, 15, 63, 63,
+	9, 11, 13, 14, 15, 63, 63, 63,
+	11, 11, 13, 14, 63, 63, 63, 63,
+	11, 13, 14, 63, 63, 63, 63, 63,
+	13, 14, 63, 63, 63, 63, 63, 63,
+	13, 63, 63, 63, 63, 63, 63, 63,
+	63, 63, 63, 63, 63, 63, 63, 63,
+}
+
+var ltQuantizationMatrix = [64]uint8{
+	4, 5, 6, 7, 9, 11, 13, 15,
+	5, 5, 7, 8, 11, 13, 15, 17,
+	6, 7, 9, 11, 13, 15, 15, 17,
+	7, 7, 9, 11, 13, 15, 17, 19,
+	7, 9, 11, 13, 14, 16, 19, 23,
+	9, 11, 13, 14, 16, 19, 23, 29,
+	9, 11, 13, 15, 17, 21, 28, 35,
+	11, 13, 16, 17, 21, 28, 35, 41,
+}
+
+var standardQuantizationMatrix = [64]uint8{
+	4, 4, 5, 5, 6, 7, 7, 9,
+	4, 4, 5, 6, 7, 7, 9, 9,
+	5, 5, 6, 7, 7, 9, 9, 10,
+	5, 5, 6, 7, 7, 9, 9, 10,
+	5, 6, 7, 7, 8, 9, 10, 12,
+	6, 7, 7, 8, 9, 10, 12, 15,
+	6, 7, 7, 9, 10, 11, 14, 17,
+	7, 7, 9, 10, 11, 14, 17, 21,
+}
+
+var hqQuantizationMatrix = [64]uint8{
+	4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 5,
+	4, 4, 4, 4, 4, 4, 5, 5,
+	4, 4, 4, 4, 4, 5, 5, 6,
+	4, 4, 4, 4, 5, 5, 6, 7,
+	4, 4, 4, 4, 5, 6, 7, 7,
+}
+
+var profiles = [...]profileInfo{
+	ProfileProxy:    {"apco", "Proxy", 4, [...]int{300, 242, 220, 194}, &proxyQuantizationMatrix, &proxyQuantizationMatrix},
+	ProfileLT:       {"apcs", "LT", 1, [...]int{720, 560, 490, 440}, &ltQuantizationMatrix, &ltQuantizationMatrix},
+	ProfileStandard: {"apcn", "Standard", 1, [...]int{1050, 808, 710, 632}, &standardQuantizationMatrix, &standardQuantizationMatrix},
+	ProfileHQ:       {"apch", "HQ", 1, [...]int{1566, 1216, 1070, 950}, &hqQuantizationMatrix, &hqQuantizationMatrix},
+	Profile4444:     {"ap4h", "4444", 1, [...]int{2350, 1828, 1600, 1425}, &hqQuantizationMatrix, &hqQuantizationMatrix},
+	Profile4444XQ:   {"ap4x", "4444 XQ", 1, [...]int{3525, 2742, 2400, 2137}, &hqQuantizationMatrix, &hqQuantizationMatrix},
+}
+
+func (p Profile) info() *profileInfo {
+	if p < 0 || int(p) >= len(profiles) {
+		return nil
+	}
+	return &profiles[p]
+}
+
+// Returns the QuickTime codec identifier for the profile, such as "apch".
+func (p Profile) FourCC() string {
+	if info := p.info(); info != nil {
+		return info.fourCC
+	}
+	return ""
+}
+
+func (p Profile) String() string {
+	if info := p.info(); info != nil {
+		return info.name
+	}
+	return fmt.Sprintf("Profile(%d)", int(p))
+}
+
+// Returns the chroma subsampling used by the profile.
+func (p Profile) SubsampleRatio() image.YCbCrSubsampleRatio {
+	if p == Profile4444 || p == Profile4444XQ {
+		return image.YCbCrSubsampleRatio444
+	}
+	return image.YCbCrSubsampleRatio422
+}
+
+// Returns the number of bits that samples are encoded with. 4:4:4 profiles use 12 bits and the
+// others use 10, which matches FrameHeader.BitDepth.
+func (p Profile) BitDepth() int {
+	if p.SubsampleRatio() == image.YCbCrSubsampleRatio444 {
+		return 12
+	}
+	return 10
+}
+
+// Returns the target number of bits per macroblock for a frame with the given number of macroblocks.
+func (p Profile) bitsPerMacroblock(macroblocks int) int {
+	info := p.info()
+	for i, limit := range macroblockLimits {
+		if macroblocks <= limit {
+			return info.bitsPerMacroblock[i]
+		}
+	}
+	return info.bitsPerMacroblock[len(macroblockLimits)-1]
+}
+
+// An Encoder encodes images as progressive ProRes frames that can be read by DecodeFrame.
+type Encoder struct {
+	Profile Profile
+
+	// These are written to the frame header as-is. If CreatorID is empty, "prgo" is used.
+	CreatorID              string
+	AspectRatio            AspectRatio
+	FrameRate              FrameRate
+	ColorPrimaries         ColorPrimaries
+	TransferCharacteristic TransferCharacteristic
+	MatrixCoefficients     MatrixCoefficients
+
+	// If set to FrameAlphaInfo8Bit or FrameAlphaInfo16Bit, the image's alpha channel is encoded
+	// losslessly with that many bits. This is only supported by the 4:4:4 profiles. The alpha
+	// channel doesn't count towards the profile's target data rate.
+	Alpha FrameAlphaInfo
+}
+
+const encoderSliceWidthFactor = 3
+
+type encodeSliceJob struct {
+	index int
+	rect  image.Rectangle
+}
+
+// Encodes img as a frame. Images that aren't an *image.YCbCr, *image.NYCbCrA, *YCbCr16, or
+// *NYCbCrA16 with the profile's subsample ratio are converted first.
+func (e *Encoder) Encode(img image.Image) ([]byte, error) {
+	info := e.Profile.info()
+	if info == nil {
+		return nil, fmt.Errorf("unsupported profile")
+	}
+	if e.Alpha.HasAlpha() {
+		if e.Alpha.BitDepth() == 0 {
+			return nil, fmt.Errorf("unsupported alpha info")
+		} else if e.Profile.SubsampleRatio() != image.YCbCrSubsampleRatio444 {
+			return nil, fmt.Errorf("alpha channels require a 4:4:4 profile")
+		}
+	}
+
+	bounds := img.Bounds()
+	if bounds.Empty() || bounds.Dx() > 0xffff || bounds.Dy() > 0xffff {
+		return nil, fmt.Errorf("unsupported image dimensions")
+	}
+	width, height := bounds.Dx(), bounds.Dy()
+
+	src := newEncoderImage(img, e.Profile.SubsampleRatio(), e.Profile.BitDepth())
+
+	config := &sliceEncoderConfig{
+		img:       src,
+		minQuant:  info.minQuant,
+		scanOrder: ProgressiveScanOrder,
+	}
+	if e.Alpha.HasAlpha() {
+		config.alpha = newEncoderAlpha(img)
+		config.alphaBitDepth = e.Alpha.BitDepth()
+	}
+	for i := 0; i < 64; i++ {
+		config.lumaMatrix[i] = int32(info.lumaMatrix[i])
+		config.chromaMatrix[i] = int32(info.chromaMatrix[i])
+	}
+
+	var rects []image.Rectangle
+	for y := 0; y < height; y += MacroblockHeight {
+		for x := 0; x < width; {
+			sliceWidth := sliceWidthAt(x, width, (1<<encoderSliceWidthFactor)*MacroblockWidth)
+			rects = append(rects, image.Rect(x, y, x+sliceWidth, y+MacroblockHeight))
+			x += sliceWidth
+		}
+	}
+	if len(rects) > 0xffff {
+		return nil, fmt.Errorf("too many slices")
+	}
+
+	macroblocks := src.Rect.Dx() / MacroblockWidth * src.Rect.Dy() / MacroblockHeight
+	bitsPerMacroblock := e.Profile.bitsPerMacroblock(macroblocks)
+
+	slices := make([][]byte, len(rects))
+
+	jobCh := make(chan *encodeSliceJob, len(rects))
+	errCh := make(chan error, 1)
+
+	var wg sync.WaitGroup
+
+	const numberOfWorkers = 8
+
+	wg.Add(numberOfWorkers)
+	for i := 0; i < numberOfWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			encoder := &sliceEncoder{}
+			for {
+				job := <-jobCh
+				if job == nil {
+					return
+				}
+				targetBits := bitsPerMacroblock * job.rect.Dx() / MacroblockWidth
+				data, err := encoder.encodeSlice(config, job.rect, targetBits)
+				if err != nil {
+					select {
+					case errCh <- err:
+					default:
+					}
+					continue
+				}
+				slices[job.index] = data
+			}
+		}()
+	}
+
+	for i, rect := range rects {
+		jobCh <- &encodeSliceJob{
+			index: i,
+			rect:  rect,
+		}
+	}
+
+	for i := 0; i < numberOfWorkers; i++ {
+		jobCh <- nil
+	}
+
+	wg.Wait()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+
+	header := e.frameHeader(width, height)
+	return appendPicture(header, slices, encoderSliceWidthFactor), nil
+}
+
+func (e *Encoder) frameHeader(width, height int) []byte {
+	info := e.Profile.info()
+
+	const headerSize = 20 + 2*64
+	buf := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(buf[0:], headerSize)
+	version := FrameHeaderVersion0
+	flags := FrameFlags(0x80) // 4:2:2, progressive
+	if e.Profile.SubsampleRatio() == image.YCbCrSubsampleRatio444 {
+		version = FrameHeaderVersion1
+		flags = 0xc0 // 4:4:4, progressive
+	} else if e.Alpha.HasAlpha() {
+		version = FrameHeaderVersion1
+	}
+	binary.BigEndian.PutUint16(buf[2:], uint16(version))
+	creatorID := e.CreatorID
+	if creatorID == "" {
+		creatorID = "prgo"
+	}
+	copy(buf[4:8], creatorID)
+	binary.BigEndian.PutUint16(buf[8:], uint16(width))
+	binary.BigEndian.PutUint16(buf[10:], uint16(height))
+	buf[12] = byte(flags)
+	buf[13] = byte(e.AspectRatio)<<4 | byte(e.FrameRate)&0x0f
+	buf[14] = byte(e.ColorPrimaries)
+	buf[15] = byte(e.TransferCharacteristic)
+	buf[16] = byte(e.MatrixCoefficients)
+	buf[17] = byte(e.Alpha) & 0x0f
+	buf[19] = 0x03 // custom luma and chroma quantization matrices
+	copy(buf[20:], info.lumaMatrix[:])
+	copy(buf[20+64:], info.chromaMatrix[:])
+	return buf
+}
+
+// Appends a picture made up of the given slices to buf.
+func appendPicture(buf []byte, slices [][]byte, sliceWidthFactor int) []byte {
+	const headerSize = 8
+
+	pictureSize := headerSize + 2*len(slices)
+	for _, slice := range slices {
+		pictureSize += len(slice)
+	}
+
+	var header [headerSize]byte
+	header[0] = headerSize << 3
+	binary.BigEndian.PutUint32(header[1:], uint32(pictureSize))
+	binary.BigEndian.PutUint16(header[5:], uint16(len(slices)))
+	header[7] = byte(sliceWidthFactor << 4)
+	buf = append(buf, header[:]...)
+
+	for _, slice := range slices {
+		buf = append(buf, byte(len(slice)>>8), byte(len(slice)))
+	}
+	for _, slice := range slices {
+		buf = append(buf, slice...)
+	}
+	return buf
+}
+
+// Scales a sample from one bit depth to another.
+func rescaleSample(v uint32, from, to int) uint16 {
+	if from < to {
+		// Replicate the high bits into the new low bits.
+		return uint16(v<<uint(to-from) | v>>uint(2*from-to))
+	}
+	return uint16(v >> uint(from-to))
+}
+
+// Converts img to a YCbCr16 with the given subsample ratio and bit depth. The result is padded to a
+// multiple of the macroblock size by replicating the edge samples.
+func newEncoderImage(img image.Image, subsampleRatio image.YCbCrSubsampleRatio, bitDepth int) *YCbCr16 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	ret := NewYCbCr16(macroblockBounds(width, height), subsampleRatio, bitDepth)
+
+	chromaWidth, chromaStep := width, 1
+	if subsampleRatio == image.YCbCrSubsampleRatio422 {
+		chromaWidth, chromaStep = (width+1)/2, 2
+	}
+
+	switch src := img.(type) {
+	case *image.NYCbCrA:
+		img = &src.YCbCr
+	case *NYCbCrA16:
+		img = &src.YCbCr16
+	}
+
+	switch src := img.(type) {
+	case *image.YCbCr:
+		if src.SubsampleRatio != subsampleRatio || src.Rect.Min.X%2 != 0 {
+			break
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				ret.Y[y*ret.YStride+x] = rescaleSample(uint32(src.Y[src.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]), 8, bitDepth)
+			}
+			for x := 0; x < chromaWidth; x++ {
+				ci := src.COffset(bounds.Min.X+x*chromaStep, bounds.Min.Y+y)
+				ret.Cb[y*ret.CStride+x] = rescaleSample(uint32(src.Cb[ci]), 8, bitDepth)
+				ret.Cr[y*ret.CStride+x] = rescaleSample(uint32(src.Cr[ci]), 8, bitDepth)
+			}
+		}
+		padEncoderImage(ret, width, height, chromaWidth)
+		return ret
+	case *YCbCr16:
+		if src.SubsampleRatio != subsampleRatio || src.Rect.Min.X%2 != 0 {
+			break
+		}
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				ret.Y[y*ret.YStride+x] = rescaleSample(uint32(src.Y[src.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]), src.BitDepth, bitDepth)
+			}
+			for x := 0; x < chromaWidth; x++ {
+				ci := src.COffset(bounds.Min.X+x*chromaStep, bounds.Min.Y+y)
+				ret.Cb[y*ret.CStride+x] = rescaleSample(uint32(src.Cb[ci]), src.BitDepth, bitDepth)
+				ret.Cr[y*ret.CStride+x] = rescaleSample(uint32(src.Cr[ci]), src.BitDepth, bitDepth)
+			}
+		}
+		padEncoderImage(ret, width, height, chromaWidth)
+		return ret
+	}
+
+	// Fall back to converting each pixel. For 4:2:2, horizontally adjacent chroma samples are
+	// averaged. The colors are converted without alpha premultiplication, since alpha is encoded
+	// separately.
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := NYCbCrA16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(NYCbCrA16Color).YCbCr16Color
+			ret.Y[y*ret.YStride+x] = rescaleSample(uint32(c.Y), 16, bitDepth)
+			if subsampleRatio == image.YCbCrSubsampleRatio422 {
+				if x%2 == 0 {
+					ret.Cb[y*ret.CStride+x/2] = rescaleSample(uint32(c.Cb), 16, bitDepth)
+					ret.Cr[y*ret.CStride+x/2] = rescaleSample(uint32(c.Cr), 16, bitDepth)
+				} else {
+					ci := y*ret.CStride + x/2
+					ret.Cb[ci] = uint16((uint32(ret.Cb[ci]) + uint32(rescaleSample(uint32(c.Cb), 16, bitDepth)) + 1) / 2)
+					ret.Cr[ci] = uint16((uint32(ret.Cr[ci]) + uint32(rescaleSample(uint32(c.Cr), 16, bitDepth)) + 1) / 2)
+				}
+			} else {
+				ret.Cb[y*ret.CStride+x] = rescaleSample(uint32(c.Cb), 16, bitDepth)
+				ret.Cr[y*ret.CStride+x] = rescaleSample(uint32(c.Cr), 16, bitDepth)
+			}
+		}
+	}
+	padEncoderImage(ret, width, height, chromaWidth)
+	return ret
+}
+
+// Returns img's alpha channel as 16-bit samples, padded to a multiple of the macroblock size by
+// replicating the edge samples. The stride is the padded width.
+func newEncoderAlpha(img image.Image) []uint16 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	padded := macroblockBounds(width, height)
+	ret := make([]uint16, padded.Dx()*padded.Dy())
+
+	for y := 0; y < height; y++ {
+		row := ret[y*padded.Dx():]
+		switch src := img.(type) {
+		case *image.NYCbCrA:
+			for x := 0; x < width; x++ {
+				row[x] = uint16(src.A[src.AOffset(bounds.Min.X+x, bounds.Min.Y+y)]) * 0x101
+			}
+		case *NYCbCrA16:
+			for x := 0; x < width; x++ {
+				row[x] = scaleTo16bit(src.A[src.AOffset(bounds.Min.X+x, bounds.Min.Y+y)], src.BitDepth)
+			}
+		default:
+			for x := 0; x < width; x++ {
+				_, _, _, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				row[x] = uint16(a)
+			}
+		}
+	}
+	padPlane(ret, padded.Dx(), width, height, padded.Dy())
+	return ret
+}
+
+// Fills the samples of img outside of the given dimensions by replicating the edge samples.
+func padEncoderImage(img *YCbCr16, width, height, chromaWidth int) {
+	padPlane(img.Y, img.YStride, width, height, img.Rect.Dy())
+	padPlane(img.Cb, img.CStride, chromaWidth, height, img.Rect.Dy())
+	padPlane(img.Cr, img.CStride, chromaWidth, height, img.Rect.Dy())
+}
+
+func padPlane(plane []uint16, stride, width, height, paddedHeight int) {
+	for y := 0; y < height; y++ {
+		row := plane[y*stride : (y+1)*stride]
+		for x := width; x < stride; x++ {
+			row[x] = row[width-1]
+		}
+	}
+	last := plane[(height-1)*stride : height*stride]
+	for y := height; y < paddedHeight; y++ {
+		copy(plane[y*stride:(y+1)*stride], last)
+	}
+}
@@ -0,0 +1,268 @@
+package prores
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns the peak signal-to-noise ratio between the luma planes of two images.
+func lumaPSNR(t *testing.T, a, b *image.YCbCr) float64 {
+	require.Equal(t, a.Bounds(), b.Bounds())
+	var sum float64
+	for y := a.Rect.Min.Y; y < a.Rect.Max.Y; y++ {
+		for x := a.Rect.Min.X; x < a.Rect.Max.X; x++ {
+			d := float64(a.Y[a.YOffset(x, y)]) - float64(b.Y[b.YOffset(x, y)])
+			sum += d * d
+		}
+	}
+	mse := sum / float64(a.Rect.Dx()*a.Rect.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+func TestEncoder_Encode(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	original, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+
+	previousSize := 0
+	for _, tc := range []struct {
+		Profile Profile
+		MinPSNR float64
+	}{
+		{ProfileProxy, 30},
+		{ProfileLT, 35},
+		{ProfileStandard, 38},
+		{ProfileHQ, 43},
+	} {
+		profile := tc.Profile
+		t.Run(profile.String(), func(t *testing.T) {
+			encoder := &Encoder{
+				Profile:   profile,
+				FrameRate: FrameRate29_97,
+			}
+			frame, err := encoder.Encode(original)
+			require.NoError(t, err)
+
+			var header FrameHeader
+			require.NoError(t, header.Decode(bytes.NewReader(frame)))
+			assert.Equal(t, "prgo", header.CreatorID)
+			assert.Equal(t, FrameRate29_97, header.FrameRate)
+			assert.Equal(t, image.YCbCrSubsampleRatio422, header.Flags.SubsampleRatio())
+
+			decoded, err := DecodeFrame(bytes.NewReader(frame), int64(len(frame)))
+			require.NoError(t, err)
+			psnr := lumaPSNR(t, original.(*image.YCbCr), decoded.(*image.YCbCr))
+			assert.True(t, psnr > tc.MinPSNR, "psnr: %v", psnr)
+
+			// The higher the profile, the larger the frame.
+			assert.True(t, len(frame) > previousSize)
+			previousSize = len(frame)
+		})
+	}
+}
+
+func TestEncoder_Encode_OddDimensions(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 20, 10+101, 20+37))
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 2), uint8(y * 3), uint8(x + y), 0xff})
+		}
+	}
+
+	frame, err := (&Encoder{Profile: ProfileHQ}).Encode(img)
+	require.NoError(t, err)
+
+	decoded, err := DecodeFrame(bytes.NewReader(frame), int64(len(frame)))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 101, 37), decoded.Bounds())
+
+	for y := 0; y < 37; y++ {
+		for x := 0; x < 101; x++ {
+			expected := color.YCbCrModel.Convert(img.At(10+x, 20+y)).(color.YCbCr)
+			actual := decoded.At(x, y).(color.YCbCr)
+			assert.InDelta(t, expected.Y, actual.Y, 3, "(%v, %v)", x, y)
+		}
+	}
+}
+
+func TestEncoder_Encode_PartialMacroblockSlices(t *testing.T) {
+	// 1080 pixels is 67.5 macroblocks, which the slice layout rounds up to 68: eight slices of 8
+	// macroblocks and one of 4 per row.
+	img := image.NewYCbCr(image.Rect(0, 0, 1080, 32), image.YCbCrSubsampleRatio422)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 1080; x++ {
+			img.Y[img.YOffset(x, y)] = uint8(x/5 + y)
+		}
+	}
+	for i := range img.Cb {
+		img.Cb[i] = 128
+		img.Cr[i] = 128
+	}
+
+	frame, err := (&Encoder{Profile: ProfileHQ}).Encode(img)
+	require.NoError(t, err)
+
+	var frameHeader FrameHeader
+	require.NoError(t, frameHeader.Decode(bytes.NewReader(frame)))
+	var pictureHeader PictureHeader
+	require.NoError(t, pictureHeader.Decode(bytes.NewReader(frame[frameHeader.HeaderSize:])))
+	assert.Equal(t, 2*9, pictureHeader.NumberOfSlices)
+
+	decoded, err := DecodeFrame(bytes.NewReader(frame), int64(len(frame)))
+	require.NoError(t, err)
+	psnr := lumaPSNR(t, img, decoded.(*image.YCbCr))
+	assert.True(t, psnr > 43, "psnr: %v", psnr)
+}
+
+func TestEncoder_Encode_4444(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/sintel-frame.icpf")
+	require.NoError(t, err)
+	original, err := DecodeFrame16(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+
+	previousSize := 0
+	for _, profile := range []Profile{Profile4444, Profile4444XQ} {
+		t.Run(profile.String(), func(t *testing.T) {
+			frame, err := (&Encoder{Profile: profile}).Encode(original)
+			require.NoError(t, err)
+
+			var header FrameHeader
+			require.NoError(t, header.Decode(bytes.NewReader(frame)))
+			assert.Equal(t, FrameHeaderVersion1, header.Version)
+			assert.Equal(t, image.YCbCrSubsampleRatio444, header.Flags.SubsampleRatio())
+			assert.Equal(t, FrameAlphaInfoNone, header.AlphaInfo)
+
+			decoded, err := DecodeFrame16(bytes.NewReader(frame), int64(len(frame)))
+			require.NoError(t, err)
+			expected, actual := original.(*YCbCr16), decoded.(*YCbCr16)
+			require.Equal(t, 12, actual.BitDepth)
+
+			var sum float64
+			for i := range expected.Y {
+				d := float64(expected.Y[i]) - float64(actual.Y[i])
+				sum += d * d
+			}
+			psnr := 10 * math.Log10(4095*4095/(sum/float64(len(expected.Y))))
+			assert.True(t, psnr > 45, "psnr: %v", psnr)
+
+			assert.True(t, len(frame) > previousSize)
+			previousSize = len(frame)
+		})
+	}
+}
+
+func TestEncoder_Encode_Alpha(t *testing.T) {
+	img := image.NewNYCbCrA(image.Rect(0, 0, 70, 40), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 70; x++ {
+			img.Y[img.YOffset(x, y)] = uint8(x + y)
+			img.Cb[img.COffset(x, y)] = 128
+			img.Cr[img.COffset(x, y)] = 128
+			switch {
+			case x < 20:
+				img.A[img.AOffset(x, y)] = 0xff
+			case x < 30:
+				img.A[img.AOffset(x, y)] = 0
+			default:
+				img.A[img.AOffset(x, y)] = uint8(x * y)
+			}
+		}
+	}
+
+	t.Run("8Bit", func(t *testing.T) {
+		frame, err := (&Encoder{Profile: Profile4444, Alpha: FrameAlphaInfo8Bit}).Encode(img)
+		require.NoError(t, err)
+
+		decoded, err := DecodeFrame(bytes.NewReader(frame), int64(len(frame)))
+		require.NoError(t, err)
+		require.IsType(t, &image.NYCbCrA{}, decoded)
+		actual := decoded.(*image.NYCbCrA)
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 70; x++ {
+				assert.Equal(t, img.A[img.AOffset(x, y)], actual.A[actual.AOffset(x, y)], "(%v, %v)", x, y)
+			}
+		}
+	})
+
+	t.Run("16Bit", func(t *testing.T) {
+		frame, err := (&Encoder{Profile: Profile4444XQ, Alpha: FrameAlphaInfo16Bit}).Encode(img)
+		require.NoError(t, err)
+
+		var header FrameHeader
+		require.NoError(t, header.Decode(bytes.NewReader(frame)))
+		assert.Equal(t, FrameAlphaInfo16Bit, header.AlphaInfo)
+
+		decoded, err := DecodeFrame16(bytes.NewReader(frame), int64(len(frame)))
+		require.NoError(t, err)
+		require.IsType(t, &NYCbCrA16{}, decoded)
+		actual := decoded.(*NYCbCrA16)
+		for y := 0; y < 40; y++ {
+			for x := 0; x < 70; x++ {
+				expected := uint16(img.A[img.AOffset(x, y)]) * 0x101 >> 4
+				assert.Equal(t, expected, actual.A[actual.AOffset(x, y)], "(%v, %v)", x, y)
+			}
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		_, err := (&Encoder{Profile: ProfileHQ, Alpha: FrameAlphaInfo8Bit}).Encode(img)
+		assert.Error(t, err)
+	})
+}
+
+func TestEncodeAlphaValues(t *testing.T) {
+	values := make([]uint16, 3000)
+	for i := range values {
+		switch {
+		case i < 2500:
+			values[i] = 0xffff
+		case i < 2600:
+			values[i] = uint16(i * 37)
+		default:
+			values[i] = uint16(0x8000 + i%7)
+		}
+	}
+
+	for _, bitDepth := range []int{8, 16} {
+		var w BitstreamWriter
+		encodeAlphaValues(&w, values, bitDepth)
+
+		decoded := make([]uint16, len(values))
+		require.NoError(t, decodeAlphaValues(&Bitstream{Bytes: w.Bytes()}, decoded, bitDepth))
+		for i, v := range values {
+			expected := v >> uint(16-bitDepth)
+			require.Equal(t, expected, decoded[i]>>uint(16-bitDepth), "bit depth: %v, index: %v", bitDepth, i)
+		}
+	}
+}
+
+func BenchmarkEncoder_Encode(b *testing.B) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	img, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	encoder := &Encoder{Profile: ProfileHQ}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := encoder.Encode(img); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package prores
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// These errors categorize why data can't be decoded. The errors returned by decoding functions match
+// at most one of them with errors.Is. Errors that don't match any of them are caused by the caller,
+// for example by passing an unsupported destination image, or are I/O errors.
+var (
+	// The data ends before everything that it declares has been read.
+	ErrTruncated = errors.New("truncated data")
+
+	// A frame, picture, or slice header, or the container around a frame, is invalid.
+	ErrInvalidHeader = errors.New("invalid header")
+
+	// The data is valid, but uses a feature that isn't supported.
+	ErrUnsupported = errors.New("unsupported feature")
+
+	// The coded coefficients or alpha values of a slice are invalid.
+	ErrCorrupt = errors.New("corrupt data")
+
+	// The frame exceeds the limits given with the Limits option.
+	ErrLimitExceeded = errors.New("decode limit exceeded")
+)
+
+// errUnexpectedEOF is returned when data ends early. It matches both ErrTruncated and
+// io.ErrUnexpectedEOF.
+var errUnexpectedEOF = fmt.Errorf("%w: %w", ErrTruncated, io.ErrUnexpectedEOF)
+
+// A Channel is one of the channels that a slice is coded in.
+type Channel int
+
+const (
+	// Used for errors that aren't specific to a channel, such as invalid slice headers.
+	ChannelNone Channel = iota
+
+	ChannelLuma
+	ChannelChromaU
+	ChannelChromaV
+	ChannelAlpha
+)
+
+func (c Channel) String() string {
+	switch c {
+	case ChannelLuma:
+		return "luma"
+	case ChannelChromaU:
+		return "chroma u"
+	case ChannelChromaV:
+		return "chroma v"
+	case ChannelAlpha:
+		return "alpha"
+	}
+	return "none"
+}
+
+// A SliceError is returned when a slice can't be decoded. Its underlying error matches one of the
+// sentinel errors above.
+type SliceError struct {
+	// The picture that the slice belongs to. This is 0 for progressive frames and for the first
+	// field of interlaced frames, and 1 for the second field.
+	Picture int
+
+	// The index of the slice within its picture. SliceDecoder.DecodeSlice doesn't know the index, so
+	// it leaves this 0.
+	Slice int
+
+	// The position of the slice's first macroblock within its picture, in macroblocks.
+	X, Y int
+
+	// The channel that couldn't be decoded, or ChannelNone if the slice couldn't be decoded at all.
+	Channel Channel
+
+	// The position in bits, relative to the beginning of the slice's header, at which the channel's
+	// data was found to be invalid. This is only set if Channel isn't ChannelNone.
+	BitOffset int
+
+	Err error
+}
+
+func (e *SliceError) Error() string {
+	if e.Channel == ChannelNone {
+		return fmt.Sprintf("unable to decode slice %v at macroblock (%v, %v): %v", e.Slice, e.X, e.Y, e.Err)
+	}
+	return fmt.Sprintf("unable to decode %v channel of slice %v at macroblock (%v, %v), bit %v: %v", e.Channel, e.Slice, e.X, e.Y, e.BitOffset, e.Err)
+}
+
+func (e *SliceError) Unwrap() error {
+	return e.Err
+}
+
+// A PanicError is the underlying error of a SliceError when decoding the slice panicked. That's a bug
+// in the decoder, but it's recovered rather than taking down the whole process. PanicError matches
+// ErrCorrupt, since only data that isn't validated well enough can cause it.
+type PanicError struct {
+	// The value that was passed to panic.
+	Value interface{}
+
+	// The stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic while decoding: %v", e.Value)
+}
+
+// Is makes PanicError match ErrCorrupt.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrCorrupt
+}
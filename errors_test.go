@@ -0,0 +1,181 @@
+package prores
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeErrors(t *testing.T) {
+	frame, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+
+	var frameHeader FrameHeader
+	require.NoError(t, frameHeader.Decode(bytes.NewReader(frame)))
+	offsets, _ := sliceSpans(t, frame)
+
+	interlaced, err := ioutil.ReadFile("testdata/bir-atl-interlaced-frame.icpf")
+	require.NoError(t, err)
+	var interlacedHeader FrameHeader
+	require.NoError(t, interlacedHeader.Decode(bytes.NewReader(interlaced)))
+	withPictureSize := func(size uint32) []byte {
+		ret := append([]byte(nil), interlaced...)
+		binary.BigEndian.PutUint32(ret[interlacedHeader.HeaderSize+1:], size)
+		return ret
+	}
+
+	for name, tc := range map[string]struct {
+		Frame    []byte
+		Options  []DecodeOption
+		Expected error
+	}{
+		"TruncatedFrameHeader": {
+			Frame:    frame[:20],
+			Expected: ErrTruncated,
+		},
+		"TruncatedPicture": {
+			Frame:    frame[:frameHeader.HeaderSize+4],
+			Expected: ErrTruncated,
+		},
+		"InvalidFrameHeaderSize": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret, 4)
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"InvalidPictureHeaderSize": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				ret[frameHeader.HeaderSize] = 3
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"UnsupportedVersion": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret[2:], 7)
+				return ret
+			}(),
+			Expected: ErrUnsupported,
+		},
+		"InvalidSliceHeaderSize": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				ret[offsets[130]] = 8
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"ZeroWidth": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret[8:], 0)
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"MissingQuantizationMatrix": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret, 20+64)
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"TooManySlices": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret[frameHeader.HeaderSize+5:], uint16(len(offsets)+1))
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"UnsupportedSliceWidth": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				ret[frameHeader.HeaderSize+7] = 4 << 4
+				return ret
+			}(),
+			Expected: ErrUnsupported,
+		},
+		"SliceDataSizes": {
+			Frame: func() []byte {
+				ret := append([]byte(nil), frame...)
+				binary.BigEndian.PutUint16(ret[offsets[130]+2:], 0xffff)
+				return ret
+			}(),
+			Expected: ErrInvalidHeader,
+		},
+		"ZeroPictureSize": {
+			Frame:    withPictureSize(0),
+			Options:  []DecodeOption{WeaveFields()},
+			Expected: ErrInvalidHeader,
+		},
+		"SmallPictureSize": {
+			Frame:    withPictureSize(uint32(interlaced[interlacedHeader.HeaderSize] / 8)),
+			Options:  []DecodeOption{WeaveFields()},
+			Expected: ErrInvalidHeader,
+		},
+		"CorruptSlice": {
+			Frame:    damageSlices(t, frame, 130),
+			Expected: ErrCorrupt,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeFrameBytes(tc.Frame, tc.Options...)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, tc.Expected), "%v", err)
+			for _, sentinel := range []error{ErrTruncated, ErrInvalidHeader, ErrUnsupported, ErrCorrupt} {
+				if sentinel != tc.Expected {
+					assert.False(t, errors.Is(err, sentinel), "%v", err)
+				}
+			}
+
+			// Decoding from an io.ReaderAt fails the same way.
+			_, err = DecodeFrame(bytes.NewReader(tc.Frame), int64(len(tc.Frame)), tc.Options...)
+			assert.True(t, errors.Is(err, tc.Expected), "%v", err)
+		})
+	}
+
+	t.Run("UnexpectedEOF", func(t *testing.T) {
+		_, err := DecodeFrameBytes(frame[:20])
+		assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+	})
+
+	t.Run("PanicError", func(t *testing.T) {
+		var err error = &SliceError{Err: &PanicError{Value: "index out of range"}}
+		assert.True(t, errors.Is(err, ErrCorrupt))
+		var panicErr *PanicError
+		require.True(t, errors.As(err, &panicErr))
+		assert.Equal(t, "index out of range", panicErr.Value)
+	})
+
+	t.Run("SliceError", func(t *testing.T) {
+		_, err := DecodeFrameBytes(damageSlices(t, frame, 130))
+		var sliceErr *SliceError
+		require.True(t, errors.As(err, &sliceErr), "%v", err)
+		assert.Equal(t, 0, sliceErr.Picture)
+		assert.Equal(t, 130, sliceErr.Slice)
+		assert.Equal(t, 80, sliceErr.X)
+		assert.Equal(t, 8, sliceErr.Y)
+		assert.NotEqual(t, ChannelNone, sliceErr.Channel)
+		assert.True(t, sliceErr.BitOffset > int(frame[offsets[130]]), "%v", sliceErr.BitOffset)
+		assert.True(t, errors.Is(sliceErr.Err, ErrCorrupt))
+
+		// Any of the slices after the truncation may be the one that's reported.
+		_, err = DecodeFrameBytes(frame[:offsets[130]+4])
+		require.True(t, errors.As(err, &sliceErr), "%v", err)
+		assert.True(t, sliceErr.Slice >= 130, "%v", sliceErr.Slice)
+		assert.Equal(t, ChannelNone, sliceErr.Channel)
+		assert.True(t, errors.Is(err, ErrTruncated))
+	})
+}
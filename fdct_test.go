@@ -0,0 +1,142 @@
+package prores
+
+import (
+	"bytes"
+	"image"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFDCT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		var samples [64]int32
+		for j := range samples {
+			samples[j] = int32(rng.Intn(1024)) - 512
+		}
+
+		coefficients := samples
+		FDCT(&coefficients)
+
+		// idct expects unscaled coefficients.
+		transformed := block(coefficients)
+		for j, c := range transformed {
+			if c < 0 {
+				transformed[j] = -((-c + 4) >> 3)
+			} else {
+				transformed[j] = (c + 4) >> 3
+			}
+		}
+		idct(&transformed)
+		for j := range samples {
+			assert.InDelta(t, samples[j], transformed[j], 1)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	flatMatrix := make([]int8, 64)
+	for i := range flatMatrix {
+		flatMatrix[i] = 4
+	}
+
+	// The proxy profile's frames have custom matrices, which should be usable as they're returned
+	// by the frame header.
+	frame, err := (&Encoder{Profile: ProfileProxy}).Encode(image.NewYCbCr(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio422))
+	require.NoError(t, err)
+	var header FrameHeader
+	require.NoError(t, header.Decode(bytes.NewReader(frame)))
+	require.NotNil(t, header.CustomLumaQuantizationMatrix)
+
+	for _, tc := range []struct {
+		Matrix            []int8
+		BitDepth          int
+		QuantizationIndex int
+		MaxRMSError       float64
+	}{
+		{flatMatrix, 10, 1, 0.5},
+		{flatMatrix, 12, 1, 2},
+		{flatMatrix, 10, 8, 4},
+		{flatMatrix, 12, 8, 16},
+		{header.LumaQuantizationMatrix(), 10, 1, 5},
+		{header.ChromaQuantizationMatrix(), 10, 4, 20},
+	} {
+		var scaledMatrix [64]int32
+		for i, v := range tc.Matrix {
+			scaledMatrix[i] = int32(v) * int32(QuantizationScale(tc.QuantizationIndex))
+		}
+
+		var sum float64
+		for i := 0; i < 100; i++ {
+			var samples [64]int32
+			for j := range samples {
+				samples[j] = int32(rng.Intn(1 << uint(tc.BitDepth)))
+			}
+
+			coefficients := samples
+			for j := range coefficients {
+				coefficients[j] -= 1 << uint(tc.BitDepth-1)
+			}
+			FDCT(&coefficients)
+
+			var quantized [64]int16
+			require.NoError(t, Quantize(&quantized, &coefficients, tc.Matrix, tc.QuantizationIndex, tc.BitDepth))
+
+			decoded := make([]uint16, 64)
+			decodeBlock16(decoded, 8, quantized, scaledMatrix, tc.BitDepth)
+			for j := range samples {
+				d := float64(samples[j]) - float64(decoded[j])
+				sum += d * d
+			}
+		}
+		rmsError := math.Sqrt(sum / (100 * 64))
+		assert.True(t, rmsError < tc.MaxRMSError, "bit depth: %v, quantization index: %v, rms error: %v", tc.BitDepth, tc.QuantizationIndex, rmsError)
+	}
+}
+
+func TestQuantize_InvalidParameters(t *testing.T) {
+	matrix := make([]int8, 64)
+	for i := range matrix {
+		matrix[i] = 4
+	}
+	zeroEntry := append([]int8(nil), matrix...)
+	zeroEntry[10] = 0
+	negativeEntry := append([]int8(nil), matrix...)
+	negativeEntry[63] = -4
+
+	for name, tc := range map[string]struct {
+		Matrix            []int8
+		QuantizationIndex int
+		BitDepth          int
+	}{
+		"ZeroQuantizationIndex":  {matrix, 0, 10},
+		"LargeQuantizationIndex": {matrix, 225, 10},
+		"ZeroMatrixEntry":        {zeroEntry, 1, 10},
+		"NegativeMatrixEntry":    {negativeEntry, 1, 10},
+		"ShortMatrix":            {matrix[:63], 1, 10},
+		"8BitSamples":            {matrix, 1, 8},
+		"16BitSamples":           {matrix, 1, 16},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var coefficients [64]int32
+			coefficients[0] = 1000
+			dest := [64]int16{1}
+			assert.Error(t, Quantize(&dest, &coefficients, tc.Matrix, tc.QuantizationIndex, tc.BitDepth))
+			assert.Equal(t, [64]int16{1}, dest)
+		})
+	}
+}
+
+func TestQuantizationScale(t *testing.T) {
+	assert.Equal(t, 1, QuantizationScale(1))
+	assert.Equal(t, 128, QuantizationScale(128))
+	assert.Equal(t, 132, QuantizationScale(129))
+	assert.Equal(t, 512, QuantizationScale(224))
+}
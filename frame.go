@@ -1,10 +1,12 @@
 package prores
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"image"
 	"io"
+	"math/bits"
 )
 
 type FrameFlags byte
@@ -30,10 +32,27 @@ func (f FrameFlags) InterlaceMode() InterlaceMode {
 
 type FrameAlphaInfo byte
 
+const (
+	FrameAlphaInfoNone  FrameAlphaInfo = 0
+	FrameAlphaInfo8Bit  FrameAlphaInfo = 1
+	FrameAlphaInfo16Bit FrameAlphaInfo = 2
+)
+
 func (i FrameAlphaInfo) HasAlpha() bool {
 	return i != 0
 }
 
+// Returns the number of bits used to code each alpha sample, or 0 if the value is unknown.
+func (i FrameAlphaInfo) BitDepth() int {
+	switch i {
+	case FrameAlphaInfo8Bit:
+		return 8
+	case FrameAlphaInfo16Bit:
+		return 16
+	}
+	return 0
+}
+
 type FrameQuantizationMatrixFlags byte
 
 func (f FrameQuantizationMatrixFlags) CustomLumaQuantizationMatrixPresent() bool {
@@ -55,12 +74,27 @@ var defaultQuantizationMatrix = []int8{
 	4, 4, 4, 4, 4, 4, 4, 4,
 }
 
+const (
+	// Version 0 frame headers are intended for 4:2:2 frames without alpha.
+	FrameHeaderVersion0 = 0
+
+	// Version 1 frame headers are required for 4:4:4 frames and frames with alpha.
+	FrameHeaderVersion1 = 1
+)
+
 type FrameHeader struct {
 	HeaderSize                     int64
 	Version                        int
+	CreatorID                      string
 	Width                          int
 	Height                         int
 	Flags                          FrameFlags
+	AspectRatio                    AspectRatio
+	FrameRate                      FrameRate
+	ColorPrimaries                 ColorPrimaries
+	TransferCharacteristic         TransferCharacteristic
+	MatrixCoefficients             MatrixCoefficients
+	SourcePixelFormat              SourcePixelFormat
 	AlphaInfo                      FrameAlphaInfo
 	QuantizationMatrixFlags        FrameQuantizationMatrixFlags
 	CustomLumaQuantizationMatrix   []int8
@@ -81,38 +115,122 @@ func (h *FrameHeader) ChromaQuantizationMatrix() []int8 {
 	return h.LumaQuantizationMatrix()
 }
 
-func (h *FrameHeader) Decode(r io.ReaderAt) error {
-	var hdrSizeBuf [2]byte
-	if _, err := r.ReadAt(hdrSizeBuf[:], 0); err != nil {
-		return err
+// Returns the number of bits of precision that DecodeFrame16 decodes samples to. 4:4:4 frames are
+// decoded to 12 bits, and 4:2:2 frames are decoded to 10 bits.
+func (h *FrameHeader) BitDepth() int {
+	if h.Flags.SubsampleRatio() == image.YCbCrSubsampleRatio444 {
+		return 12
 	}
+	return 10
+}
+
+// The largest frame header size that we accept. The spec allows larger headers, but anything beyond
+// the quantization matrices is ignored anyway.
+const maxFrameHeaderSize = 1024
 
-	hdrSize := binary.BigEndian.Uint16(hdrSizeBuf[:])
+// Returns the size in bytes of a frame header given its first two bytes.
+func frameHeaderSize(b []byte) (int, error) {
+	hdrSize := binary.BigEndian.Uint16(b)
 	if hdrSize < 28 {
-		return fmt.Errorf("header size must be at least 28")
-	} else if hdrSize > 1024 {
+		return 0, fmt.Errorf("%w: header size must be at least 28", ErrInvalidHeader)
+	} else if hdrSize > maxFrameHeaderSize {
 		// to keep us from choking on bad data. not dictated by spec
-		return fmt.Errorf("header size must be less than or equal to 1024")
+		return 0, fmt.Errorf("%w: header size must be less than or equal to %v", ErrInvalidHeader, maxFrameHeaderSize)
 	}
+	return int(hdrSize), nil
+}
+
+func (h *FrameHeader) Decode(r io.ReaderAt) error {
+	var buf [maxFrameHeaderSize]byte
+	var decoded FrameHeader
+	if err := decoded.decode(unboundedReaderData(r), &buf); err != nil {
+		return err
+	}
+	*h = decoded
+	return nil
+}
 
-	buf := make([]byte, hdrSize)
-	if _, err := r.ReadAt(buf, 0); err != nil {
+// Like Decode, but decodes the header from the beginning of data. If data isn't in memory, the header
+// is read into buf.
+func (h *FrameHeader) decode(data encodedData, buf *[maxFrameHeaderSize]byte) error {
+	b, err := data.bytes(0, 2, buf[:])
+	if err != nil {
 		return err
 	}
 
+	hdrSize, err := frameHeaderSize(b)
+	if err != nil {
+		return err
+	}
+
+	b, err = data.bytes(0, int64(hdrSize), buf[:])
+	if err != nil {
+		return err
+	}
+	return h.decodeBytes(b)
+}
+
+// Like Decode, but decodes the header from the beginning of b. If h already has a creator ID or custom
+// quantization matrices, their memory is reused.
+func (h *FrameHeader) decodeBytes(b []byte) error {
+	if len(b) < 2 {
+		return errUnexpectedEOF
+	}
+	hdrSize, err := frameHeaderSize(b)
+	if err != nil {
+		return err
+	} else if len(b) < hdrSize {
+		return errUnexpectedEOF
+	}
+	buf := b[:hdrSize]
+
+	// Comparing doesn't allocate, so this avoids allocating when the header is reused.
+	creatorID := h.CreatorID
+	if creatorID != string(buf[4:8]) {
+		creatorID = string(buf[4:8])
+	}
+
 	decoded := FrameHeader{
 		HeaderSize:              int64(hdrSize),
 		Version:                 int(binary.BigEndian.Uint16(buf[2:])),
+		CreatorID:               creatorID,
 		Width:                   int(binary.BigEndian.Uint16(buf[8:])),
 		Height:                  int(binary.BigEndian.Uint16(buf[10:])),
 		Flags:                   FrameFlags(buf[12]),
+		AspectRatio:             AspectRatio(buf[13] >> 4),
+		FrameRate:               FrameRate(buf[13] & 0x0f),
+		ColorPrimaries:          ColorPrimaries(buf[14]),
+		TransferCharacteristic:  TransferCharacteristic(buf[15]),
+		MatrixCoefficients:      MatrixCoefficients(buf[16]),
+		SourcePixelFormat:       SourcePixelFormat(buf[17] >> 4),
 		AlphaInfo:               FrameAlphaInfo(buf[17] & 0x0f),
 		QuantizationMatrixFlags: FrameQuantizationMatrixFlags(buf[19]),
 	}
 
+	// Strictly speaking, version 0 frames can't be 4:4:4 or have alpha, but some encoders write
+	// version 0 headers for 4:4:4 frames anyway. So we don't reject them and honor the flags for both
+	// versions. Later versions may lay the header out differently though.
+	if decoded.Version > FrameHeaderVersion1 {
+		return fmt.Errorf("%w: frame header version %v", ErrUnsupported, decoded.Version)
+	}
+	if decoded.Width == 0 || decoded.Height == 0 {
+		return fmt.Errorf("%w: frame dimensions must be non-zero", ErrInvalidHeader)
+	}
+
 	customMatrixOffset := 20
+	matrixCount := 0
+	if decoded.QuantizationMatrixFlags.CustomLumaQuantizationMatrixPresent() {
+		matrixCount++
+	}
+	if decoded.QuantizationMatrixFlags.CustomChromaQuantizationMatrixPresent() {
+		matrixCount++
+	}
+	if customMatrixOffset+64*matrixCount > hdrSize {
+		return fmt.Errorf("%w: header size %v is too small for its quantization matrices", ErrInvalidHeader, hdrSize)
+	}
+
 	if decoded.QuantizationMatrixFlags.CustomLumaQuantizationMatrixPresent() {
-		m := make([]int8, 64)
+		m := reuseQuantizationMatrix(h.CustomLumaQuantizationMatrix)
 		for i := range m {
 			m[i] = int8(buf[customMatrixOffset+i])
 		}
@@ -120,7 +238,7 @@ func (h *FrameHeader) Decode(r io.ReaderAt) error {
 		customMatrixOffset += 64
 	}
 	if decoded.QuantizationMatrixFlags.CustomChromaQuantizationMatrixPresent() {
-		m := make([]int8, 64)
+		m := reuseQuantizationMatrix(h.CustomChromaQuantizationMatrix)
 		for i := range m {
 			m[i] = int8(buf[customMatrixOffset+i])
 		}
@@ -131,11 +249,403 @@ func (h *FrameHeader) Decode(r io.ReaderAt) error {
 	return nil
 }
 
-func DecodeFrame(r io.ReaderAt, size int64) (image.Image, error) {
-	var header FrameHeader
-	if err := header.Decode(r); err != nil {
+// Returns m resized to hold a quantization matrix, or a new slice if it's too small.
+func reuseQuantizationMatrix(m []int8) []int8 {
+	if cap(m) < 64 {
+		return make([]int8, 64)
+	}
+	return m[:64]
+}
+
+// A DecodeOption configures how DecodeFrame and DecodeFrame16 decode a frame.
+type DecodeOption func(*decodeOptions)
+
+type decodeOptions struct {
+	weaveFields bool
+	precision   IDCTPrecision
+	concealment *Concealment
+	limits      DecodeLimits
+
+	// 0 for full-size output
+	scaleShift uint
+	scaleErr   error
+}
+
+// WeaveFields causes both fields of interlaced frames to be decoded and interleaved row by row into a
+// single full-height image. Without it, only the first field is decoded and a half-height image is
+// returned. It has no effect on progressive frames.
+func WeaveFields() DecodeOption {
+	return func(o *decodeOptions) {
+		o.weaveFields = true
+	}
+}
+
+// ScaleDown causes frames to be decoded at 1/factor of their size in each dimension, rounded up.
+// factor must be 1, 2, 4, or 8. Instead of decoding the full-size frame and resizing it, this
+// transforms only the low frequency coefficients of each block, which is much faster. At 1/8 scale,
+// only the DC coefficients are decoded at all. Alpha channels are point sampled. The chroma
+// subsampling of the output is the same as the frame's. The IDCT precision has no effect on scaled
+// output.
+func ScaleDown(factor int) DecodeOption {
+	return func(o *decodeOptions) {
+		switch factor {
+		case 1, 2, 4, 8:
+			o.scaleShift = uint(bits.TrailingZeros(uint(factor)))
+			o.scaleErr = nil
+		default:
+			o.scaleErr = fmt.Errorf("unsupported scale factor %v", factor)
+		}
+	}
+}
+
+// DecodeLimits bounds the resources that decoding a frame can use. Frames that exceed any of the
+// limits are rejected with an error matching ErrLimitExceeded before the memory for them is
+// allocated. Zero fields impose no limit, except for MaxWidth and MaxHeight.
+type DecodeLimits struct {
+	// The maximum width and height of frames in pixels. If zero, DefaultMaxDimension is used. If
+	// negative, there's no limit.
+	MaxWidth, MaxHeight int
+
+	// The maximum number of slices in each picture.
+	MaxSlices int
+
+	// The maximum size of frames in bytes, including any icpf container.
+	MaxFrameBytes int64
+}
+
+// The maximum width and height of frames when DecodeLimits doesn't give them, which is enough for 8K
+// video. Even at this size, decoding a frame can take hundreds of megabytes.
+const DefaultMaxDimension = 8192
+
+// Returns the limit to apply for MaxWidth or MaxHeight, or 0 if there's no limit.
+func maxDimension(limit int) int {
+	if limit == 0 {
+		return DefaultMaxDimension
+	} else if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// Limits rejects frames that exceed the given limits. Without it, only the default limits on width
+// and height apply.
+func Limits(limits DecodeLimits) DecodeOption {
+	return func(o *decodeOptions) {
+		o.limits = limits
+	}
+}
+
+// IDCTPrecision selects the inverse DCT used to decode frames.
+type IDCTPrecision int
+
+const (
+	// The default inverse DCT is fast and accurate to within one in the least significant bit, but
+	// its output doesn't exactly match other decoders'.
+	IDCTPrecisionDefault IDCTPrecision = iota
+
+	// The integer inverse DCT is a translation of the one in FFmpeg's prores decoder (ff_prores_idct_10
+	// and ff_prores_idct_12), so its output doesn't depend on the platform. It hasn't been verified
+	// against FFmpeg's output though, so don't rely on the two being bit-exact. Like that decoder, it
+	// clips 10-bit output to [4, 1019] and 12-bit output to [4, 4091]. 8-bit output is the 10-bit
+	// output shifted right by 2. It's slower than the default.
+	IDCTPrecisionInteger
+)
+
+// Precision selects the inverse DCT used to decode frames.
+func Precision(precision IDCTPrecision) DecodeOption {
+	return func(o *decodeOptions) {
+		o.precision = precision
+	}
+}
+
+// Decodes a frame into an 8-bit image. If the frame has an alpha channel, the result is an
+// *image.NYCbCrA. Otherwise it's an *image.YCbCr. The frame may be wrapped in an icpf container, as
+// it is in QuickTime movies. See NewFrameReader.
+func DecodeFrame(r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return defaultDecoder().DecodeFrame(r, size, opts...)
+}
+
+// DecodeFrameContext is like DecodeFrame, but it gives up as soon as ctx is done. No more slices are
+// decoded once that happens, and ctx.Err() is returned after any slices that are already being
+// decoded finish.
+func DecodeFrameContext(ctx context.Context, r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return defaultDecoder().DecodeFrameContext(ctx, r, size, opts...)
+}
+
+// DecodeFrame16 is like DecodeFrame, but it decodes samples at their full precision (10 bits for
+// 4:2:2 frames, 12 bits for 4:4:4 frames) into a *YCbCr16 or *NYCbCrA16.
+func DecodeFrame16(r io.ReaderAt, size int64, opts ...DecodeOption) (image.Image, error) {
+	return defaultDecoder().DecodeFrame16(r, size, opts...)
+}
+
+// DecodeFrameInto is like DecodeFrame or DecodeFrame16, but it decodes into dst instead of allocating
+// a new image. dst must have the type that DecodeFrame or DecodeFrame16 would return for the frame,
+// the same subsample ratio and bit depth, and exactly the same bounds. Its strides may be larger than
+// necessary.
+func DecodeFrameInto(dst image.Image, r io.ReaderAt, size int64, opts ...DecodeOption) error {
+	return defaultDecoder().DecodeFrameInto(dst, r, size, opts...)
+}
+
+// DecodeFrameBytes is like DecodeFrame, but it decodes a frame that's already in memory. The headers
+// and slices are decoded directly from b without being copied, so it's faster than passing b to
+// DecodeFrame via a bytes.Reader. b must not be modified until DecodeFrameBytes returns.
+func DecodeFrameBytes(b []byte, opts ...DecodeOption) (image.Image, error) {
+	return defaultDecoder().DecodeFrameBytes(b, opts...)
+}
+
+// DecodeFrameRegion is like DecodeFrame, but only decodes the part of the frame within rect, which is
+// given in the coordinates of the image that DecodeFrame would return with the same options. Only
+// the slices that intersect rect are decoded, so small regions are much faster to decode than whole
+// frames. The returned image's bounds are rect clipped to the frame. If rect doesn't intersect the
+// frame at all, an error is returned.
+func DecodeFrameRegion(r io.ReaderAt, size int64, rect image.Rectangle, opts ...DecodeOption) (image.Image, error) {
+	return defaultDecoder().DecodeFrameRegion(r, size, rect, opts...)
+}
+
+// Applies the options, decodes the frame header, and locates the pictures of the frame in data.
+func (f *frameDecode) begin(data encodedData, opts []DecodeOption) error {
+	options := &f.options
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.scaleErr != nil {
+		return options.scaleErr
+	}
+
+	limits := &options.limits
+	if limits.MaxFrameBytes > 0 && data.Size() > limits.MaxFrameBytes {
+		return fmt.Errorf("%w: frame is %v bytes, which is more than %v", ErrLimitExceeded, data.Size(), limits.MaxFrameBytes)
+	}
+
+	offset, _, err := frameOffset(data, &f.containerBuf)
+	if err != nil {
+		return err
+	}
+	frame := data.section(offset, data.Size()-offset)
+	if err := f.header.decode(frame, &f.headerBuf); err != nil {
+		return err
+	}
+	if maxWidth := maxDimension(limits.MaxWidth); maxWidth > 0 && f.header.Width > maxWidth {
+		return fmt.Errorf("%w: frame width %v is more than %v", ErrLimitExceeded, f.header.Width, maxWidth)
+	} else if maxHeight := maxDimension(limits.MaxHeight); maxHeight > 0 && f.header.Height > maxHeight {
+		return fmt.Errorf("%w: frame height %v is more than %v", ErrLimitExceeded, f.header.Height, maxHeight)
+	}
+	f.pictures = frame.section(f.header.HeaderSize, frame.Size()-f.header.HeaderSize)
+
+	// Make sure that the data is large enough for the dimensions before anything is allocated for
+	// them, so that a few bytes can't declare a frame that takes gigabytes to decode.
+	minSize, ok := minPictureSize(f.header.Width, pictureHeight(&f.header, FieldOrderFirst))
+	if !ok {
+		return fmt.Errorf("%w: a %vx%v frame needs more slices than a picture can have", ErrInvalidHeader, f.header.Width, f.header.Height)
+	} else if f.pictures.Size() < minSize {
+		return fmt.Errorf("%w: a %vx%v frame needs at least %v bytes of picture data, but there are only %v", ErrTruncated, f.header.Width, f.header.Height, minSize, f.pictures.Size())
+	}
+	return nil
+}
+
+// Returns the bounds of the image that the frame is decoded into.
+func (f *frameDecode) bounds(options *decodeOptions) image.Rectangle {
+	width, height := f.header.Width, pictureHeight(&f.header, FieldOrderFirst)
+	if options.weaveFields {
+		height = f.header.Height
+	}
+	return scaleBounds(image.Rect(0, 0, width, height), options.scaleShift)
+}
+
+// Scales a rectangle with its origin at (0, 0) down by 2^shift, rounding up.
+func scaleBounds(r image.Rectangle, shift uint) image.Rectangle {
+	return image.Rect(0, 0, (r.Max.X+1<<shift-1)>>shift, (r.Max.Y+1<<shift-1)>>shift)
+}
+
+func (d *Decoder) decodeFrame(ctx context.Context, data encodedData, highBitDepth bool, opts []DecodeOption) (image.Image, error) {
+	f := d.getFrameDecode()
+	defer d.putFrameDecode(f)
+
+	if err := f.begin(data, opts); err != nil {
+		return nil, err
+	}
+	options := &f.options
+
+	// The image is tall enough to hold macroblock-aligned pictures so that slices never need to be
+	// clipped. When fields are woven together, each field is decoded into every other row.
+	header := &f.header
+	bounds := macroblockBounds(header.Width, pictureHeight(header, FieldOrderFirst))
+	if options.weaveFields && header.Flags.InterlaceMode() != InterlaceModeNone {
+		fieldBounds := scaleBounds(macroblockBounds(header.Width, (header.Height+1)/2), options.scaleShift)
+		bounds = image.Rect(0, 0, fieldBounds.Dx(), 2*fieldBounds.Dy())
+	} else {
+		bounds = scaleBounds(bounds, options.scaleShift)
+	}
+	img := newPictureImage(header, bounds, highBitDepth)
+
+	writers, err := newSliceWriters(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.decodePictures(ctx, f, &writers, options); err != nil {
+		return nil, err
+	}
+	return img.SubImage(f.bounds(options)), nil
+}
+
+func (d *Decoder) decodeFrameRegion(ctx context.Context, data encodedData, rect image.Rectangle, opts []DecodeOption) (image.Image, error) {
+	f := d.getFrameDecode()
+	defer d.putFrameDecode(f)
+
+	if err := f.begin(data, opts); err != nil {
+		return nil, err
+	}
+	options := &f.options
+
+	bounds := rect.Intersect(f.bounds(options))
+	if bounds.Empty() {
+		return nil, fmt.Errorf("region %v is outside of the frame bounds %v", rect, f.bounds(options))
+	}
+
+	// Slices that fall outside of the image are skipped, and the ones that straddle its edges are
+	// clipped.
+	img := newPictureImage(&f.header, bounds, false)
+	writers, err := newSliceWriters(img)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.decodePictures(ctx, f, &writers, options); err != nil {
 		return nil, err
 	}
+	return img, nil
+}
+
+func (d *Decoder) decodeFrameInto(ctx context.Context, dst image.Image, data encodedData, opts []DecodeOption) error {
+	f := d.getFrameDecode()
+	defer d.putFrameDecode(f)
+
+	if err := f.begin(data, opts); err != nil {
+		return err
+	}
+	options := &f.options
+	if err := validateDestination(dst, &f.header, f.bounds(options)); err != nil {
+		return err
+	}
+
+	writers, err := newSliceWriters(dst)
+	if err != nil {
+		return err
+	}
+	return d.decodePictures(ctx, f, &writers, options)
+}
+
+// Checks that dst is suitable for decoding a frame with the given header and output bounds into.
+func validateDestination(dst image.Image, header *FrameHeader, bounds image.Rectangle) error {
+	var ycbcr *image.YCbCr
+	var ycbcr16 *YCbCr16
+	hasAlpha := false
+	switch dst := dst.(type) {
+	case *image.YCbCr:
+		ycbcr = dst
+	case *image.NYCbCrA:
+		ycbcr = &dst.YCbCr
+		hasAlpha = true
+		if err := validatePlane(len(dst.A), dst.AStride, bounds.Dx(), bounds.Dy()); err != nil {
+			return fmt.Errorf("invalid destination alpha plane: %v", err)
+		}
+	case *YCbCr16:
+		ycbcr16 = dst
+	case *NYCbCrA16:
+		ycbcr16 = &dst.YCbCr16
+		hasAlpha = true
+		if err := validatePlane(len(dst.A), dst.AStride, bounds.Dx(), bounds.Dy()); err != nil {
+			return fmt.Errorf("invalid destination alpha plane: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported destination image type %T", dst)
+	}
+
+	if hasAlpha != header.AlphaInfo.HasAlpha() {
+		return fmt.Errorf("destination image type %T doesn't match the frame's alpha channel", dst)
+	} else if dst.Bounds() != bounds {
+		return fmt.Errorf("destination bounds %v don't match the frame's bounds %v", dst.Bounds(), bounds)
+	}
+
+	var subsampleRatio image.YCbCrSubsampleRatio
+	var yLen, cLen, yStride, cStride int
+	if ycbcr != nil {
+		subsampleRatio = ycbcr.SubsampleRatio
+		yLen, cLen = len(ycbcr.Y), min(len(ycbcr.Cb), len(ycbcr.Cr))
+		yStride, cStride = ycbcr.YStride, ycbcr.CStride
+	} else {
+		if ycbcr16.BitDepth != header.BitDepth() {
+			return fmt.Errorf("destination bit depth %v doesn't match the frame's bit depth %v", ycbcr16.BitDepth, header.BitDepth())
+		}
+		subsampleRatio = ycbcr16.SubsampleRatio
+		yLen, cLen = len(ycbcr16.Y), min(len(ycbcr16.Cb), len(ycbcr16.Cr))
+		yStride, cStride = ycbcr16.YStride, ycbcr16.CStride
+	}
+
+	if subsampleRatio != header.Flags.SubsampleRatio() {
+		return fmt.Errorf("destination subsample ratio %v doesn't match the frame's subsample ratio %v", subsampleRatio, header.Flags.SubsampleRatio())
+	}
+	w, h, cw, ch := yCbCrSize(bounds, subsampleRatio)
+	if err := validatePlane(yLen, yStride, w, h); err != nil {
+		return fmt.Errorf("invalid destination luma plane: %v", err)
+	} else if err := validatePlane(cLen, cStride, cw, ch); err != nil {
+		return fmt.Errorf("invalid destination chroma plane: %v", err)
+	}
+	return nil
+}
+
+// Checks that a plane with the given length and stride can hold width by height samples.
+func validatePlane(length, stride, width, height int) error {
+	if stride < width {
+		return fmt.Errorf("stride %v is less than the width %v", stride, width)
+	} else if height > 0 && length < (height-1)*stride+width {
+		return fmt.Errorf("%v samples are too few for %vx%v samples with a stride of %v", length, width, height, stride)
+	}
+	return nil
+}
+
+// Decodes the frame's pictures using writers.
+func (d *Decoder) decodePictures(ctx context.Context, f *frameDecode, writers *sliceWriters, options *decodeOptions) error {
+	writers.setPrecision(options.precision)
+	writers.setScaleShift(options.scaleShift)
+
+	previous, err := f.picture.beginConcealment(writers, options)
+	if err != nil {
+		return err
+	}
+	defer f.picture.endConcealment()
+
+	header := &f.header
+	f.picture.index = 0
+	f.picture.maxSlices = options.limits.MaxSlices
+	if !options.weaveFields || header.Flags.InterlaceMode() == InterlaceModeNone {
+		bounds := macroblockBounds(header.Width, pictureHeight(header, FieldOrderFirst))
+		f.picture.previous = previous
+		return d.decodePictureInto(ctx, &f.picture, writers, bounds, f.pictures, header)
+	}
+
+	var firstPictureHeader PictureHeader
+	if err := firstPictureHeader.decode(f.pictures, &f.picture.headerBuf); err != nil {
+		return err
+	}
+	if minSize := firstPictureHeader.HeaderSize + 2*int64(firstPictureHeader.NumberOfSlices); firstPictureHeader.PictureSize < minSize {
+		return fmt.Errorf("%w: picture size %v is smaller than the picture's header and index table", ErrInvalidHeader, firstPictureHeader.PictureSize)
+	} else if firstPictureHeader.PictureSize >= f.pictures.Size() {
+		return fmt.Errorf("%w: second picture is missing", ErrTruncated)
+	}
+
+	// Both fields are decoded into pictures tall enough to hold the taller of the two.
+	fieldBounds := macroblockBounds(header.Width, (header.Height+1)/2)
+
+	firstIsTop := header.Flags.InterlaceMode() == InterlaceModeTopFirst
+	first := writers.field(firstIsTop)
+	f.picture.previous = previous.field(firstIsTop)
+	if err := d.decodePictureInto(ctx, &f.picture, &first, fieldBounds, f.pictures, header); err != nil {
+		return err
+	}
 
-	return DecodePicture(io.NewSectionReader(r, header.HeaderSize, size-header.HeaderSize), &header, FieldOrderFirst)
+	secondPicture := f.pictures.section(firstPictureHeader.PictureSize, f.pictures.Size()-firstPictureHeader.PictureSize)
+	second := writers.field(!firstIsTop)
+	f.picture.previous = previous.field(!firstIsTop)
+	f.picture.index = 1
+	return d.decodePictureInto(ctx, &f.picture, &second, fieldBounds, secondPicture, header)
 }
@@ -2,13 +2,52 @@ package prores
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
 	"io/ioutil"
+	"math"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestFrameHeader_Decode(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/sintel-frame.icpf")
+	require.NoError(t, err)
+
+	var header FrameHeader
+	require.NoError(t, header.Decode(bytes.NewReader(buf)))
+	assert.EqualValues(t, 148, header.HeaderSize)
+	assert.Equal(t, FrameHeaderVersion0, header.Version)
+	assert.Equal(t, "ap10", header.CreatorID)
+	assert.Equal(t, 1920, header.Width)
+	assert.Equal(t, 1080, header.Height)
+	assert.Equal(t, image.YCbCrSubsampleRatio444, header.Flags.SubsampleRatio())
+	assert.Equal(t, InterlaceModeNone, header.Flags.InterlaceMode())
+	assert.Equal(t, AspectRatioUnknown, header.AspectRatio)
+	assert.Equal(t, FrameRateUnknown, header.FrameRate)
+	assert.Equal(t, ColorPrimariesUnspecified, header.ColorPrimaries)
+	assert.Equal(t, TransferCharacteristicUnspecified, header.TransferCharacteristic)
+	assert.Equal(t, MatrixCoefficientsUnspecified, header.MatrixCoefficients)
+	assert.EqualValues(t, 4, header.SourcePixelFormat)
+	assert.False(t, header.AlphaInfo.HasAlpha())
+	assert.Len(t, header.CustomLumaQuantizationMatrix, 64)
+	assert.Len(t, header.CustomChromaQuantizationMatrix, 64)
+
+	t.Run("UnsupportedVersion", func(t *testing.T) {
+		buf := append([]byte(nil), buf...)
+		buf[3] = 2
+		assert.Error(t, header.Decode(bytes.NewReader(buf)))
+	})
+}
+
 func TestDecodeFrame(t *testing.T) {
 	t.Run("Skycam", func(t *testing.T) {
 		buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
@@ -27,19 +66,475 @@ func TestDecodeFrame(t *testing.T) {
 		assert.Equal(t, 1920, img.Bounds().Dx())
 		assert.Equal(t, 540, img.Bounds().Dy())
 	})
+
+	t.Run("BIR-ATL-Interlaced-Woven", func(t *testing.T) {
+		buf, err := ioutil.ReadFile("testdata/bir-atl-interlaced-frame.icpf")
+		require.NoError(t, err)
+
+		field, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+		require.NoError(t, err)
+
+		img, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)), WeaveFields())
+		require.NoError(t, err)
+		assert.Equal(t, 1920, img.Bounds().Dx())
+		assert.Equal(t, 1080, img.Bounds().Dy())
+
+		// The frame is top field first, so the first field should make up the even rows.
+		fieldYCbCr := field.(*image.YCbCr)
+		imgYCbCr := img.(*image.YCbCr)
+		for y := 0; y < 540; y++ {
+			require.Equal(t, fieldYCbCr.Y[fieldYCbCr.YOffset(0, y):][:1920], imgYCbCr.Y[imgYCbCr.YOffset(0, 2*y):][:1920])
+			require.Equal(t, fieldYCbCr.Cb[fieldYCbCr.COffset(0, y):][:960], imgYCbCr.Cb[imgYCbCr.COffset(0, 2*y):][:960])
+		}
+
+		// The second field should be similar to the first, but not identical.
+		difference := 0
+		for y := 0; y < 540; y++ {
+			for x := 0; x < 1920; x++ {
+				d := int(imgYCbCr.Y[imgYCbCr.YOffset(x, 2*y)]) - int(imgYCbCr.Y[imgYCbCr.YOffset(x, 2*y+1)])
+				if d < 0 {
+					d = -d
+				}
+				difference += d
+			}
+		}
+		assert.NotZero(t, difference)
+		assert.True(t, difference/(1920*540) < 16, "average difference: %v", difference/(1920*540))
+	})
+}
+
+func TestDecodeFrame_PartialMacroblockSlices(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	full, err := DecodeFrameBytes(buf)
+	require.NoError(t, err)
+
+	// Narrowing the frame to 1912 pixels leaves a partial macroblock at the right edge, which still
+	// counts toward the slice layout. So each row keeps its 15 slices of 8 macroblocks instead of
+	// ending in slices of 4, 2, 1, and 1.
+	narrow := append([]byte(nil), buf...)
+	binary.BigEndian.PutUint16(narrow[8:], 1912)
+	img, err := DecodeFrameBytes(narrow)
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 1912, 1080), img.Bounds())
+	fullYCbCr := full.(*image.YCbCr)
+	imgYCbCr := img.(*image.YCbCr)
+	for y := 0; y < 1080; y++ {
+		require.Equal(t, fullYCbCr.Y[fullYCbCr.YOffset(0, y):][:1912], imgYCbCr.Y[imgYCbCr.YOffset(0, y):][:1912])
+	}
+
+	for slice, pos := range map[int]image.Point{14: {112, 0}, 15: {0, 1}} {
+		_, err := DecodeFrameBytes(damageSlices(t, narrow, slice))
+		var sliceErr *SliceError
+		require.True(t, errors.As(err, &sliceErr), "%v", err)
+		assert.Equal(t, slice, sliceErr.Slice)
+		assert.Equal(t, pos, image.Pt(sliceErr.X, sliceErr.Y))
+	}
+}
+
+func TestDecodeFrameContext(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+
+	t.Run("Background", func(t *testing.T) {
+		expected, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+		require.NoError(t, err)
+		img, err := DecodeFrameContext(context.Background(), bytes.NewReader(buf), int64(len(buf)))
+		require.NoError(t, err)
+		assert.Equal(t, expected, img)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		img, err := DecodeFrameContext(ctx, bytes.NewReader(buf), int64(len(buf)))
+		assert.Nil(t, img)
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("DeadlineExceeded", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		_, err := DecodeFrameContext(ctx, bytes.NewReader(buf), int64(len(buf)), WeaveFields())
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("CorruptSlice", func(t *testing.T) {
+		corrupt := append([]byte(nil), buf...)
+		for i := len(corrupt) / 2; i < len(corrupt); i++ {
+			corrupt[i] = 0
+		}
+		img, err := DecodeFrameContext(context.Background(), bytes.NewReader(corrupt), int64(len(corrupt)))
+		assert.Nil(t, img)
+		assert.Error(t, err)
+	})
+}
+
+func TestDecodeFrameBytes(t *testing.T) {
+	for name, tc := range map[string]struct {
+		Path string
+		Opts []DecodeOption
+	}{
+		"Skycam":                   {"testdata/skycam-frame.icpf", nil},
+		"Sintel":                   {"testdata/sintel-frame.icpf", nil},
+		"BIR-ATL-Interlaced-Woven": {"testdata/bir-atl-interlaced-frame.icpf", []DecodeOption{WeaveFields()}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(tc.Path)
+			require.NoError(t, err)
+
+			expected, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)), tc.Opts...)
+			require.NoError(t, err)
+			img, err := DecodeFrameBytes(buf, tc.Opts...)
+			require.NoError(t, err)
+			assert.Equal(t, expected, img)
+
+			img, err = DecodeFrameBytes(wrapFrame(buf, len(buf)+8), tc.Opts...)
+			require.NoError(t, err)
+			assert.Equal(t, expected, img)
+		})
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+		require.NoError(t, err)
+
+		for _, n := range []int{0, 1, 20, 100, 200, len(buf) / 2, len(buf) - 1} {
+			_, err := DecodeFrameBytes(buf[:n])
+			assert.Error(t, err, "length: %v", n)
+		}
+	})
+}
+
+func TestDecodeFrame_Limits(t *testing.T) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+
+	// The frame is 1920x1080 with 1020 slices.
+	for name, tc := range map[string]struct {
+		Limits   DecodeLimits
+		Exceeded bool
+	}{
+		"Zero":          {DecodeLimits{}, false},
+		"NoDimensions":  {DecodeLimits{MaxWidth: -1, MaxHeight: -1}, false},
+		"Exact":         {DecodeLimits{MaxWidth: 1920, MaxHeight: 1080, MaxSlices: 1020, MaxFrameBytes: int64(len(buf))}, false},
+		"MaxWidth":      {DecodeLimits{MaxWidth: 1919}, true},
+		"MaxHeight":     {DecodeLimits{MaxHeight: 1079}, true},
+		"MaxSlices":     {DecodeLimits{MaxSlices: 1019}, true},
+		"MaxFrameBytes": {DecodeLimits{MaxFrameBytes: int64(len(buf)) - 1}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeFrameBytes(buf, Limits(tc.Limits))
+			if !tc.Exceeded {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+
+			_, err = DecodeFrameRegion(bytes.NewReader(buf), int64(len(buf)), image.Rect(0, 0, 16, 16), Limits(tc.Limits))
+			assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+
+			dst := image.NewYCbCr(image.Rect(0, 0, 1920, 1080), image.YCbCrSubsampleRatio422)
+			err = DecodeFrameInto(dst, bytes.NewReader(buf), int64(len(buf)), Limits(tc.Limits))
+			assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		})
+	}
+
+	withSize := func(b []byte, width, height int) []byte {
+		ret := append([]byte(nil), b...)
+		binary.BigEndian.PutUint16(ret[8:], uint16(width))
+		binary.BigEndian.PutUint16(ret[10:], uint16(height))
+		return ret
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		_, err := DecodeFrameBytes(withSize(buf, DefaultMaxDimension+1, 1080))
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+		_, err = DecodeFrameBytes(withSize(buf, 1920, DefaultMaxDimension+1))
+		assert.True(t, errors.Is(err, ErrLimitExceeded), "%v", err)
+	})
+
+	// A small frame can't declare dimensions that would take much more memory than it could fill,
+	// even without limits.
+	t.Run("SmallFrame", func(t *testing.T) {
+		frame := withSize(buf[:300], DefaultMaxDimension, DefaultMaxDimension)
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, err := DecodeFrameBytes(frame)
+		runtime.ReadMemStats(&after)
+		assert.True(t, errors.Is(err, ErrTruncated), "%v", err)
+		assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, "%v bytes allocated", after.TotalAlloc-before.TotalAlloc)
+
+		_, err = DecodeFrameBytes(withSize(buf[:300], 0xffff, 0xffff), Limits(DecodeLimits{MaxWidth: -1, MaxHeight: -1}))
+		assert.True(t, errors.Is(err, ErrInvalidHeader), "%v", err)
+	})
+}
+
+func TestDecodeFrame16(t *testing.T) {
+	for name, tc := range map[string]struct {
+		Path     string
+		BitDepth int
+	}{
+		"Skycam": {"testdata/skycam-frame.icpf", 10},
+		"Sintel": {"testdata/sintel-frame.icpf", 12},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(tc.Path)
+			require.NoError(t, err)
+
+			img8, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+			require.NoError(t, err)
+			img16, err := DecodeFrame16(bytes.NewReader(buf), int64(len(buf)))
+			require.NoError(t, err)
+
+			ycbcr8 := img8.(*image.YCbCr)
+			ycbcr16 := img16.(*YCbCr16)
+			assert.Equal(t, tc.BitDepth, ycbcr16.BitDepth)
+			assert.Equal(t, ycbcr8.Bounds(), ycbcr16.Bounds())
+			assert.Equal(t, ycbcr8.SubsampleRatio, ycbcr16.SubsampleRatio)
+
+			// The 8-bit samples should be the high bits of the full precision samples, give or take
+			// rounding differences.
+			maxDifference := 0
+			shift := uint(tc.BitDepth - 8)
+			for y := 0; y < ycbcr8.Bounds().Dy(); y++ {
+				for x := 0; x < ycbcr8.Bounds().Dx(); x++ {
+					d := int(ycbcr16.Y[ycbcr16.YOffset(x, y)]>>shift) - int(ycbcr8.Y[ycbcr8.YOffset(x, y)])
+					if d < 0 {
+						d = -d
+					}
+					if d > maxDifference {
+						maxDifference = d
+					}
+				}
+			}
+			if tc.BitDepth == 10 {
+				assert.Equal(t, 0, maxDifference)
+			} else {
+				assert.True(t, maxDifference <= 1, "max difference: %v", maxDifference)
+			}
+		})
+	}
+}
+
+// Returns the MD5 hash of the image's planes, one after another, with little-endian samples and no
+// padding between rows. This is what FFmpeg's framemd5 muxer hashes for yuv422p10le and yuv444p12le
+// frames.
+func planesMD5(img *YCbCr16) string {
+	h := md5.New()
+	bounds := img.Bounds()
+	write := func(pix []uint16, offset func(x, y int) int, width int) {
+		row := make([]byte, 2*width)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := 0; x < width; x++ {
+				binary.LittleEndian.PutUint16(row[2*x:], pix[offset(bounds.Min.X, y)+x])
+			}
+			h.Write(row)
+		}
+	}
+	chromaWidth := bounds.Dx()
+	if img.SubsampleRatio == image.YCbCrSubsampleRatio422 {
+		chromaWidth = (chromaWidth + 1) / 2
+	}
+	write(img.Y, img.YOffset, bounds.Dx())
+	write(img.Cb, img.COffset, chromaWidth)
+	write(img.Cr, img.COffset, chromaWidth)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func TestDecodeFrame_IntegerPrecision(t *testing.T) {
+	// The expected hashes were recorded from this decoder to catch changes to its output. They
+	// haven't been compared with FFmpeg's output.
+	for name, tc := range map[string]struct {
+		Path string
+		MD5  string
+	}{
+		"Skycam":     {"testdata/skycam-frame.icpf", "004e6666a98e57b94130fa4c5a76deed"},
+		"Sintel":     {"testdata/sintel-frame.icpf", "5b319d7ebaf49ef30f41ea1533128fdf"},
+		"Interlaced": {"testdata/bir-atl-interlaced-frame.icpf", "0b00c906996c49f7d7a6bf63f328a284"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(tc.Path)
+			require.NoError(t, err)
+
+			img16, err := DecodeFrame16(bytes.NewReader(buf), int64(len(buf)), WeaveFields(), Precision(IDCTPrecisionInteger))
+			require.NoError(t, err)
+			ycbcr16 := img16.(*YCbCr16)
+			assert.Equal(t, tc.MD5, planesMD5(ycbcr16))
+
+			// Samples are clipped to the range that's legal for video.
+			for _, pix := range [][]uint16{ycbcr16.Y, ycbcr16.Cb, ycbcr16.Cr} {
+				for _, v := range pix {
+					require.True(t, v >= 4 && v <= 1<<uint(ycbcr16.BitDepth)-5, "sample: %v", v)
+				}
+			}
+
+			// For 10-bit frames, the 8-bit samples are the high bits of the 10-bit samples.
+			if ycbcr16.BitDepth == 10 {
+				img8, err := DecodeFrameBytes(buf, WeaveFields(), Precision(IDCTPrecisionInteger))
+				require.NoError(t, err)
+				ycbcr8 := img8.(*image.YCbCr)
+				for y := 0; y < ycbcr8.Bounds().Dy(); y++ {
+					for x := 0; x < ycbcr8.Bounds().Dx(); x++ {
+						require.Equal(t, uint8(ycbcr16.Y[ycbcr16.YOffset(x, y)]>>2), ycbcr8.Y[ycbcr8.YOffset(x, y)])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeFrame_ScaleDown(t *testing.T) {
+	for name, path := range map[string]string{
+		"Skycam":     "testdata/skycam-frame.icpf",
+		"Sintel":     "testdata/sintel-frame.icpf",
+		"Interlaced": "testdata/bir-atl-interlaced-frame.icpf",
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+
+			img, err := DecodeFrameBytes(buf)
+			require.NoError(t, err)
+			full := img.(*image.YCbCr)
+
+			for _, factor := range []int{1, 2, 4, 8} {
+				img, err := DecodeFrameBytes(buf, ScaleDown(factor))
+				require.NoError(t, err)
+				scaled := img.(*image.YCbCr)
+
+				expectedBounds := image.Rect(0, 0, (full.Rect.Dx()+factor-1)/factor, (full.Rect.Dy()+factor-1)/factor)
+				require.Equal(t, expectedBounds, scaled.Bounds())
+				assert.Equal(t, full.SubsampleRatio, scaled.SubsampleRatio)
+
+				img16, err := DecodeFrame16(bytes.NewReader(buf), int64(len(buf)), ScaleDown(factor))
+				require.NoError(t, err)
+				assert.Equal(t, expectedBounds, img16.Bounds())
+
+				// Each sample should be close to the average of the samples it replaces.
+				var totalError float64
+				for y := 0; y < full.Rect.Dy()/factor; y++ {
+					for x := 0; x < full.Rect.Dx()/factor; x++ {
+						sum := 0
+						for dy := 0; dy < factor; dy++ {
+							for dx := 0; dx < factor; dx++ {
+								sum += int(full.Y[full.YOffset(x*factor+dx, y*factor+dy)])
+							}
+						}
+						average := float64(sum) / float64(factor*factor)
+						totalError += math.Abs(average - float64(scaled.Y[scaled.YOffset(x, y)]))
+					}
+				}
+				meanError := totalError / float64(full.Rect.Dx()/factor*full.Rect.Dy()/factor)
+				assert.True(t, meanError < 2, "factor: %v, mean error: %v", factor, meanError)
+			}
+
+			_, err = DecodeFrameBytes(buf, ScaleDown(3))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecodeFrameRegion(t *testing.T) {
+	for name, path := range map[string]string{
+		"Skycam":     "testdata/skycam-frame.icpf",
+		"Sintel":     "testdata/sintel-frame.icpf",
+		"Interlaced": "testdata/bir-atl-interlaced-frame.icpf",
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(path)
+			require.NoError(t, err)
+
+			for optionsName, opts := range map[string][]DecodeOption{
+				"Default":     nil,
+				"WeaveFields": {WeaveFields()},
+				"ScaleDown":   {WeaveFields(), ScaleDown(4)},
+			} {
+				t.Run(optionsName, func(t *testing.T) {
+					img, err := DecodeFrameBytes(buf, opts...)
+					require.NoError(t, err)
+					full := img.(*image.YCbCr)
+
+					for _, rect := range []image.Rectangle{
+						full.Rect,
+						image.Rect(0, 0, 1, 1),
+						image.Rect(17, 33, 18, 34),
+						image.Rect(101, 55, 190, 201),
+						image.Rect(full.Rect.Dx()-50, full.Rect.Dy()-31, full.Rect.Dx()+50, full.Rect.Dy()+50),
+					} {
+						img, err := DecodeFrameRegion(bytes.NewReader(buf), int64(len(buf)), rect, opts...)
+						require.NoError(t, err)
+						region := img.(*image.YCbCr)
+						require.Equal(t, rect.Intersect(full.Rect), region.Rect)
+						assert.Equal(t, full.SubsampleRatio, region.SubsampleRatio)
+
+						for y := region.Rect.Min.Y; y < region.Rect.Max.Y; y++ {
+							for x := region.Rect.Min.X; x < region.Rect.Max.X; x++ {
+								require.Equal(t, full.YCbCrAt(x, y), region.YCbCrAt(x, y), "rect: %v, x: %v, y: %v", rect, x, y)
+							}
+						}
+					}
+
+					_, err = DecodeFrameRegion(bytes.NewReader(buf), int64(len(buf)), image.Rect(-10, -10, 0, 0), opts...)
+					assert.Error(t, err)
+				})
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeFrameRegion_Skycam(b *testing.B) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(buf)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeFrameRegion(r, int64(len(buf)), image.Rect(1000, 500, 1256, 756)); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
 
-func benchmarkDecodeFrame(b *testing.B, path string) {
+func BenchmarkDecodeFrame_Skycam_ScaleDown8(b *testing.B) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeFrameBytes(buf, ScaleDown(8)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkDecodeFrame(b *testing.B, path string, opts ...DecoderOption) {
 	buf, err := ioutil.ReadFile(path)
 	if err != nil {
 		b.Fatal(err)
 	}
 	r := bytes.NewReader(buf)
 
+	decode := DecodeFrame
+	if opts != nil {
+		decoder := NewDecoder(opts...)
+		defer decoder.Close()
+		decode = decoder.DecodeFrame
+	}
+
+	b.ReportAllocs()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
-		if _, err := DecodeFrame(r, int64(len(buf))); err != nil {
+		if _, err := decode(r, int64(len(buf))); err != nil {
 			b.Fatal(err)
 		}
 	}
@@ -52,3 +547,144 @@ func BenchmarkDecodeFrame_Sintel(b *testing.B) {
 func BenchmarkDecodeFrame_Skycam(b *testing.B) {
 	benchmarkDecodeFrame(b, "testdata/skycam-frame.icpf")
 }
+
+func benchmarkDecodeFrameBytes(b *testing.B, path string) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeFrameBytes(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeFrameBytes_Sintel(b *testing.B) {
+	benchmarkDecodeFrameBytes(b, "testdata/sintel-frame.icpf")
+}
+
+func BenchmarkDecodeFrameBytes_Skycam(b *testing.B) {
+	benchmarkDecodeFrameBytes(b, "testdata/skycam-frame.icpf")
+}
+
+func BenchmarkDecodeFrame_Skycam_SingleThreaded(b *testing.B) {
+	benchmarkDecodeFrame(b, "testdata/skycam-frame.icpf", SingleThreaded())
+}
+
+// Decodes a frame per iteration using a new pool of 8 workers each time, which is what every frame
+// cost before Decoder kept its workers around. Compare with BenchmarkDecodeFrame_Skycam.
+func BenchmarkDecodeFrame_Skycam_NewDecoder(b *testing.B) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(buf)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		decoder := NewDecoder(WorkerCount(8))
+		if _, err := decoder.DecodeFrame(r, int64(len(buf))); err != nil {
+			b.Fatal(err)
+		}
+		decoder.Close()
+	}
+}
+
+func TestDecodeFrameInto(t *testing.T) {
+	for name, tc := range map[string]struct {
+		Path string
+		Opts []DecodeOption
+	}{
+		"Skycam":                   {"testdata/skycam-frame.icpf", nil},
+		"Sintel":                   {"testdata/sintel-frame.icpf", nil},
+		"BIR-ATL-Interlaced":       {"testdata/bir-atl-interlaced-frame.icpf", nil},
+		"BIR-ATL-Interlaced-Woven": {"testdata/bir-atl-interlaced-frame.icpf", []DecodeOption{WeaveFields()}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			buf, err := ioutil.ReadFile(tc.Path)
+			require.NoError(t, err)
+
+			expected, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)), tc.Opts...)
+			require.NoError(t, err)
+			expectedYCbCr := expected.(*image.YCbCr)
+
+			// Tightly packed planes exercise the clipping of blocks at the bottom edge.
+			img := image.NewYCbCr(expected.Bounds(), expectedYCbCr.SubsampleRatio)
+			require.NoError(t, DecodeFrameInto(img, bytes.NewReader(buf), int64(len(buf)), tc.Opts...))
+			for y := 0; y < img.Rect.Dy(); y++ {
+				require.Equal(t, expectedYCbCr.Y[expectedYCbCr.YOffset(0, y):][:img.Rect.Dx()], img.Y[img.YOffset(0, y):][:img.Rect.Dx()])
+			}
+			for y := 0; y < img.Rect.Dy(); y++ {
+				require.Equal(t, expected.At(img.Rect.Dx()-1, y), img.At(img.Rect.Dx()-1, y))
+			}
+
+			expected16, err := DecodeFrame16(bytes.NewReader(buf), int64(len(buf)), tc.Opts...)
+			require.NoError(t, err)
+			img16 := NewYCbCr16(expected16.Bounds(), expectedYCbCr.SubsampleRatio, expected16.(*YCbCr16).BitDepth)
+			require.NoError(t, DecodeFrameInto(img16, bytes.NewReader(buf), int64(len(buf)), tc.Opts...))
+			for y := 0; y < img.Rect.Dy(); y += 7 {
+				for x := 0; x < img.Rect.Dx(); x += 3 {
+					require.Equal(t, expected16.At(x, y), img16.At(x, y))
+				}
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+		require.NoError(t, err)
+
+		header, err := DecodeFrame(bytes.NewReader(buf), int64(len(buf)))
+		require.NoError(t, err)
+		bounds := header.Bounds()
+		ratio := header.(*image.YCbCr).SubsampleRatio
+
+		narrow := image.NewYCbCr(bounds, ratio)
+		narrow.CStride--
+
+		for name, dst := range map[string]image.Image{
+			"Bounds":         image.NewYCbCr(bounds.Inset(1), ratio),
+			"SubsampleRatio": image.NewYCbCr(bounds, image.YCbCrSubsampleRatio420),
+			"Stride":         narrow,
+			"Alpha":          image.NewNYCbCrA(bounds, ratio),
+			"BitDepth":       NewYCbCr16(bounds, ratio, 12),
+			"Type":           image.NewRGBA(bounds),
+		} {
+			assert.Error(t, DecodeFrameInto(dst, bytes.NewReader(buf), int64(len(buf))), name)
+		}
+	})
+}
+
+func BenchmarkDecodeFrameInto_Skycam(b *testing.B) {
+	buf, err := ioutil.ReadFile("testdata/skycam-frame.icpf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := bytes.NewReader(buf)
+
+	decoder := NewDecoder()
+	defer decoder.Close()
+
+	img, err := decoder.DecodeFrame(r, int64(len(buf)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	dst := image.NewYCbCr(img.Bounds(), img.(*image.YCbCr).SubsampleRatio)
+
+	// After the first frame, there should be nothing left to allocate.
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := decoder.DecodeFrameInto(dst, r, int64(len(buf))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package prores
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The fuzz targets are seeded with the frames in testdata, along with small frames from the encoder.
+// Inputs that have caused problems are kept in testdata/fuzz so that they're run as regression
+// tests by go test.
+
+// Returns the frames in testdata followed by small encoded frames, which are much faster to mutate.
+func fuzzSeedFrames(f *testing.F) [][]byte {
+	paths, err := filepath.Glob("testdata/*.icpf")
+	if err != nil {
+		f.Fatal(err)
+	}
+	var frames [][]byte
+	for _, path := range paths {
+		frame, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+
+	gradient := image.NewNYCbCrA(image.Rect(0, 0, 40, 24), image.YCbCrSubsampleRatio444)
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 40; x++ {
+			gradient.Y[gradient.YOffset(x, y)] = uint8(x * 6)
+			gradient.Cb[gradient.COffset(x, y)] = uint8(y * 10)
+			gradient.Cr[gradient.COffset(x, y)] = uint8(255 - x*6)
+			gradient.A[gradient.AOffset(x, y)] = uint8(x * y)
+		}
+	}
+	for _, encoder := range []Encoder{
+		{Profile: ProfileProxy},
+		{Profile: Profile4444, Alpha: FrameAlphaInfo8Bit},
+		{Profile: Profile4444XQ, Alpha: FrameAlphaInfo16Bit},
+	} {
+		frame, err := encoder.Encode(gradient)
+		if err != nil {
+			f.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+func FuzzFrameHeader_Decode(f *testing.F) {
+	for _, frame := range fuzzSeedFrames(f) {
+		f.Add(frame[:min(len(frame), maxFrameHeaderSize)])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var header FrameHeader
+		if err := header.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if header.HeaderSize > int64(len(data)) {
+			t.Fatalf("header size %v is larger than the data", header.HeaderSize)
+		}
+
+		// Decoding from memory must give the same result.
+		var fromBytes FrameHeader
+		if err := fromBytes.decodeBytes(data); err != nil {
+			t.Fatal(err)
+		}
+		if fromBytes.HeaderSize != header.HeaderSize || fromBytes.Width != header.Width || fromBytes.Height != header.Height {
+			t.Fatalf("decodeBytes gave %+v, but Decode gave %+v", fromBytes, header)
+		}
+		header.LumaQuantizationMatrix()
+		header.ChromaQuantizationMatrix()
+	})
+}
+
+func FuzzPictureHeader_Decode(f *testing.F) {
+	for _, frame := range fuzzSeedFrames(f) {
+		var frameHeader FrameHeader
+		if err := frameHeader.Decode(bytes.NewReader(frame)); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(frame[frameHeader.HeaderSize:][:maxPictureHeaderSize])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var header PictureHeader
+		if err := header.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if header.HeaderSize > int64(len(data)) {
+			t.Fatalf("header size %v is larger than the data", header.HeaderSize)
+		}
+	})
+}
+
+func FuzzSliceHeader_Decode(f *testing.F) {
+	for _, frame := range fuzzSeedFrames(f) {
+		offsets, _ := sliceSpans(f, frame)
+		f.Add(frame[offsets[0]:][:8])
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var header SliceHeader
+		if err := header.Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+		if header.HeaderSize > int64(len(data)) {
+			t.Fatalf("header size %v is larger than the data", header.HeaderSize)
+		}
+	})
+}
+
+func FuzzCodeParameters_Decode(f *testing.F) {
+	for _, p := range append(dcCodeParams[:], append(acRunCodeParams[:], acLevelCodeParams[:]...)...) {
+		f.Add(byte(p), []byte{0x0a, 0xa6, 0x3f, 0xff, 0xff, 0xff})
+	}
+	f.Fuzz(func(t *testing.T, p byte, data []byte) {
+		params := CodeParameters(p)
+		bs := &Bitstream{Bytes: data}
+		for {
+			offset := bs.Offset
+			var v int
+			if !params.Decode(bs, &v) {
+				return
+			}
+			if bs.Offset <= offset || bs.Offset > len(data)*8 {
+				t.Fatalf("offset went from %v to %v with %v bits", offset, bs.Offset, len(data)*8)
+			}
+
+			// Every decoded value must be encoded the same way.
+			var w BitstreamWriter
+			params.Encode(&w, v)
+			if w.Len() != bs.Offset-offset {
+				t.Fatalf("%v was decoded from %v bits, but encoded in %v", v, bs.Offset-offset, w.Len())
+			}
+			var decoded int
+			if !params.Decode(&Bitstream{Bytes: w.Bytes()}, &decoded) || decoded != v {
+				t.Fatalf("%v was encoded, but %v was decoded", v, decoded)
+			}
+		}
+	})
+}
+
+func FuzzDecodeCoefficients(f *testing.F) {
+	for _, frame := range fuzzSeedFrames(f) {
+		offsets, _ := sliceSpans(f, frame)
+		var header SliceHeader
+		if err := header.decodeBytes(frame[offsets[0]:]); err != nil {
+			f.Fatal(err)
+		}
+		luma := frame[offsets[0]+int(header.HeaderSize):][:header.LumaDataSize]
+		f.Add(luma, uint8(5), false)
+		f.Add(luma, uint8(5), true)
+	}
+	d := NewSliceDecoder()
+	f.Fuzz(func(t *testing.T, data []byte, log2Blocks uint8, interlaced bool) {
+		// Slices always have a power of two number of blocks.
+		numberOfBlocks := 1 << (log2Blocks % 6)
+		scanOrder := ProgressiveScanOrder
+		if interlaced {
+			scanOrder = InterlacedScanOrder
+		}
+		var coeffs [MaxBlocksPerSlice][64]int16
+		bs := &Bitstream{Bytes: data}
+		if err := d.decodeCoefficients(&coeffs, bs, numberOfBlocks, scanOrder); err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if bs.Offset > len(data)*8 {
+			t.Fatalf("offset %v is past the end of %v bits", bs.Offset, len(data)*8)
+		}
+	})
+}
+
+func FuzzDecodeFrame(f *testing.F) {
+	for _, frame := range fuzzSeedFrames(f) {
+		f.Add(frame)
+	}
+	limits := Limits(DecodeLimits{
+		MaxWidth:  2048,
+		MaxHeight: 2048,
+	})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Panics in slices are recovered and returned as errors, which would hide them from the fuzzer.
+		check := func(err error) {
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				t.Fatalf("%v\n%s", err, panicErr.Stack)
+			}
+		}
+
+		img, err := DecodeFrameBytes(data, limits)
+		check(err)
+		if err != nil {
+			return
+		}
+
+		frame := data
+		if len(frame) >= frameContainerHeaderSize && string(frame[4:8]) == frameContainerType {
+			frame = frame[frameContainerHeaderSize:]
+		}
+		var header FrameHeader
+		if err := header.decodeBytes(frame); err != nil {
+			t.Fatal(err)
+		}
+		if expected := image.Rect(0, 0, header.Width, pictureHeight(&header, FieldOrderFirst)); img.Bounds() != expected {
+			t.Fatalf("bounds are %v, but should be %v", img.Bounds(), expected)
+		}
+
+		r := bytes.NewReader(data)
+		_, err = DecodeFrame16(r, int64(len(data)), limits, WeaveFields(), Precision(IDCTPrecisionInteger))
+		check(err)
+		_, err = DecodeFrameRegion(r, int64(len(data)), image.Rect(20, 20, 60, 60), limits, ScaleDown(2))
+		check(err)
+		_, err = DecodeFrameBytes(data, limits, ScaleDown(8), ConcealErrors(Concealment{Method: ConcealCopyAbove}))
+		check(err)
+	})
+}
@@ -1,6 +1,10 @@
 module github.com/theaaf/prores-go
 
+go 1.21
+
+require github.com/stretchr/testify v1.3.0
+
 require (
-	github.com/pkg/errors v0.8.1
-	github.com/stretchr/testify v1.3.0
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 )
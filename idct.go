@@ -70,6 +70,15 @@ const (
 // discrete W transform and for the discrete Fourier transform", IEEE Trans. on
 // ASSP, Vol. ASSP- 32, pp. 803-816, Aug. 1984.
 func idct(src *block) {
+	idctWithExtraBits(src, 0)
+}
+
+// genericIDCT is the portable implementation of idctWithExtraBits. Architecture-specific
+// implementations must produce exactly the same output for every input.
+func genericIDCT(src *block, extraBits uint) {
+	rounding := int32(8192) >> extraBits
+	shift := 14 - extraBits
+
 	// Horizontal 1-D IDCT.
 	for y := 0; y < 8; y++ {
 		y8 := y * 8
@@ -143,7 +152,7 @@ func idct(src *block) {
 		// we do not bother to check for the all-zero case.
 
 		// Prescale.
-		y0 := (src[8*0+x] << 8) + 8192
+		y0 := (src[8*0+x] << 8) + rounding
 		y1 := src[8*4+x] << 8
 		y2 := src[8*6+x]
 		y3 := src[8*2+x]
@@ -180,13 +189,13 @@ func idct(src *block) {
 		y4 = (r2*(y4-y5) + 128) >> 8
 
 		// Stage 4.
-		src[8*0+x] = (y7 + y1) >> 14
-		src[8*1+x] = (y3 + y2) >> 14
-		src[8*2+x] = (y0 + y4) >> 14
-		src[8*3+x] = (y8 + y6) >> 14
-		src[8*4+x] = (y8 - y6) >> 14
-		src[8*5+x] = (y0 - y4) >> 14
-		src[8*6+x] = (y3 - y2) >> 14
-		src[8*7+x] = (y7 - y1) >> 14
+		src[8*0+x] = (y7 + y1) >> shift
+		src[8*1+x] = (y3 + y2) >> shift
+		src[8*2+x] = (y0 + y4) >> shift
+		src[8*3+x] = (y8 + y6) >> shift
+		src[8*4+x] = (y8 - y6) >> shift
+		src[8*5+x] = (y0 - y4) >> shift
+		src[8*6+x] = (y3 - y2) >> shift
+		src[8*7+x] = (y7 - y1) >> shift
 	}
 }
@@ -0,0 +1,54 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package prores
+
+// Whether the CPU and OS support AVX2. This is set when the package is initialized.
+var useAVX2 = hasAVX2()
+
+// idctWithExtraBits is like idct, but scales the output up by 2^extraBits, keeping that many bits of
+// the fractional component that idct would round away. This is used for output with more than 10 bits
+// of precision.
+//
+// If the CPU supports AVX2, all eight rows or columns of each pass are transformed at once.
+// Otherwise, this is genericIDCT.
+func idctWithExtraBits(src *block, extraBits uint) {
+	if useAVX2 {
+		idctAVX2(src, int32(8192)>>extraBits, uint64(14-extraBits))
+		return
+	}
+	genericIDCT(src, extraBits)
+}
+
+// Like genericIDCT, but takes the vertical pass's rounding term and final shift directly.
+//
+//go:noescape
+func idctAVX2(src *block, rounding int32, shift uint64)
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax, edx uint32)
+
+func hasAVX2() bool {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false
+	}
+
+	// The OS must save the YMM registers, which requires OSXSAVE and the SSE and AVX state bits of
+	// XCR0.
+	const (
+		osxsave = 1 << 27
+		avx     = 1 << 28
+	)
+	if _, _, ecx1, _ := cpuid(1, 0); ecx1&(osxsave|avx) != osxsave|avx {
+		return false
+	}
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+
+	const avx2 = 1 << 5
+	_, ebx7, _, _ := cpuid(7, 0)
+	return ebx7&avx2 != 0
+}
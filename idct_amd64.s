@@ -0,0 +1,275 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// Each constant is repeated across all eight lanes of a vector.
+#define VECTOR(name, value) \
+	DATA name<>+0x00(SB)/4, $value \
+	DATA name<>+0x04(SB)/4, $value \
+	DATA name<>+0x08(SB)/4, $value \
+	DATA name<>+0x0c(SB)/4, $value \
+	DATA name<>+0x10(SB)/4, $value \
+	DATA name<>+0x14(SB)/4, $value \
+	DATA name<>+0x18(SB)/4, $value \
+	DATA name<>+0x1c(SB)/4, $value \
+	GLOBL name<>(SB), RODATA|NOPTR, $32
+
+VECTOR(w3, 2408)
+VECTOR(w6, 1108)
+VECTOR(w7, 565)
+VECTOR(w1pw7, 3406)
+VECTOR(w1mw7, 2276)
+VECTOR(w2pw6, 3784)
+VECTOR(w2mw6, 1568)
+VECTOR(w3pw5, 4017)
+VECTOR(w3mw5, 799)
+VECTOR(r2, 181)
+VECTOR(four, 4)
+VECTOR(oneTwentyEight, 128)
+
+// Transposes the 8x8 matrix of 32-bit integers whose rows are r0 through r7 into t0 through t7,
+// clobbering r0 through r7.
+#define TRANSPOSE(r0, r1, r2, r3, r4, r5, r6, r7, t0, t1, t2, t3, t4, t5, t6, t7) \
+	VPUNPCKLDQ r1, r0, t0 \
+	VPUNPCKHDQ r1, r0, t1 \
+	VPUNPCKLDQ r3, r2, t2 \
+	VPUNPCKHDQ r3, r2, t3 \
+	VPUNPCKLDQ r5, r4, t4 \
+	VPUNPCKHDQ r5, r4, t5 \
+	VPUNPCKLDQ r7, r6, t6 \
+	VPUNPCKHDQ r7, r6, t7 \
+	VPUNPCKLQDQ t2, t0, r0 \
+	VPUNPCKHQDQ t2, t0, r1 \
+	VPUNPCKLQDQ t3, t1, r2 \
+	VPUNPCKHQDQ t3, t1, r3 \
+	VPUNPCKLQDQ t6, t4, r4 \
+	VPUNPCKHQDQ t6, t4, r5 \
+	VPUNPCKLQDQ t7, t5, r6 \
+	VPUNPCKHQDQ t7, t5, r7 \
+	VPERM2I128 $0x20, r4, r0, t0 \
+	VPERM2I128 $0x31, r4, r0, t4 \
+	VPERM2I128 $0x20, r5, r1, t1 \
+	VPERM2I128 $0x31, r5, r1, t5 \
+	VPERM2I128 $0x20, r6, r2, t2 \
+	VPERM2I128 $0x31, r6, r2, t6 \
+	VPERM2I128 $0x20, r7, r3, t3 \
+	VPERM2I128 $0x31, r7, r3, t7
+
+// func idctAVX2(src *block, rounding int32, shift uint64)
+//
+// This computes exactly what genericIDCT does, but transforms all eight rows or columns of a pass at
+// once. Each pass transposes the block first so that lane i of every vector belongs to row or column
+// i. The comments name the variables of genericIDCT.
+TEXT ·idctAVX2(SB), NOSPLIT, $0-24
+	MOVQ src+0(FP), AX
+	MOVL rounding+8(FP), CX
+	MOVQ shift+16(FP), BX
+
+	VMOVDQU 0(AX), Y8
+	VMOVDQU 32(AX), Y9
+	VMOVDQU 64(AX), Y10
+	VMOVDQU 96(AX), Y11
+	VMOVDQU 128(AX), Y12
+	VMOVDQU 160(AX), Y13
+	VMOVDQU 192(AX), Y14
+	VMOVDQU 224(AX), Y15
+	TRANSPOSE(Y8, Y9, Y10, Y11, Y12, Y13, Y14, Y15, Y0, Y1, Y2, Y3, Y4, Y5, Y6, Y7)
+
+	// Horizontal 1-D IDCT. Y0 through Y7 hold the coefficients 0 through 7 of each row.
+
+	// Rows whose AC components are all zero are handled separately. Y15 is the mask of those rows and
+	// Y14 is their result.
+	VPOR Y1, Y2, Y15
+	VPOR Y3, Y15, Y15
+	VPOR Y4, Y15, Y15
+	VPOR Y5, Y15, Y15
+	VPOR Y6, Y15, Y15
+	VPOR Y7, Y15, Y15
+	VPXOR Y13, Y13, Y13
+	VPCMPEQD Y13, Y15, Y15
+	VPSLLD $3, Y0, Y14
+
+	// Prescale. x0 = Y0, x1 = Y4, x2 = Y6, x3 = Y2, x4 = Y1, x5 = Y7, x6 = Y5, x7 = Y3
+	VPSLLD $11, Y0, Y0
+	VPADDD oneTwentyEight<>(SB), Y0, Y0
+	VPSLLD $11, Y4, Y4
+
+	// Stage 1. x8 = Y8
+	VPADDD Y7, Y1, Y8
+	VPMULLD w7<>(SB), Y8, Y8
+	VPMULLD w1mw7<>(SB), Y1, Y9
+	VPADDD Y9, Y8, Y1
+	VPMULLD w1pw7<>(SB), Y7, Y9
+	VPSUBD Y9, Y8, Y7
+	VPADDD Y3, Y5, Y8
+	VPMULLD w3<>(SB), Y8, Y8
+	VPMULLD w3mw5<>(SB), Y5, Y9
+	VPSUBD Y9, Y8, Y5
+	VPMULLD w3pw5<>(SB), Y3, Y9
+	VPSUBD Y9, Y8, Y3
+
+	// Stage 2.
+	VPADDD Y4, Y0, Y8
+	VPSUBD Y4, Y0, Y0
+	VPADDD Y6, Y2, Y4
+	VPMULLD w6<>(SB), Y4, Y4
+	VPMULLD w2pw6<>(SB), Y6, Y9
+	VPSUBD Y9, Y4, Y6
+	VPMULLD w2mw6<>(SB), Y2, Y9
+	VPADDD Y9, Y4, Y2
+	VPADDD Y5, Y1, Y4
+	VPSUBD Y5, Y1, Y1
+	VPADDD Y3, Y7, Y5
+	VPSUBD Y3, Y7, Y7
+
+	// Stage 3.
+	VPADDD Y2, Y8, Y3
+	VPSUBD Y2, Y8, Y8
+	VPADDD Y6, Y0, Y2
+	VPSUBD Y6, Y0, Y0
+	VPADDD Y7, Y1, Y6
+	VPMULLD r2<>(SB), Y6, Y6
+	VPADDD oneTwentyEight<>(SB), Y6, Y6
+	VPSRAD $8, Y6, Y6
+	VPSUBD Y7, Y1, Y1
+	VPMULLD r2<>(SB), Y1, Y1
+	VPADDD oneTwentyEight<>(SB), Y1, Y1
+	VPSRAD $8, Y1, Y1
+
+	// Stage 4. The outputs 0 through 7 go to Y9, Y3, Y2, Y0, Y1, Y6, Y4, and Y10.
+	VPADDD Y4, Y3, Y9
+	VPSUBD Y4, Y3, Y10
+	VPADDD Y6, Y2, Y3
+	VPSUBD Y6, Y2, Y4
+	VPADDD Y1, Y0, Y2
+	VPSUBD Y1, Y0, Y6
+	VPADDD Y5, Y8, Y0
+	VPSUBD Y5, Y8, Y1
+	VPSRAD $8, Y9, Y9
+	VPSRAD $8, Y3, Y3
+	VPSRAD $8, Y2, Y2
+	VPSRAD $8, Y0, Y0
+	VPSRAD $8, Y1, Y1
+	VPSRAD $8, Y6, Y6
+	VPSRAD $8, Y4, Y4
+	VPSRAD $8, Y10, Y10
+	VPBLENDVB Y15, Y14, Y9, Y9
+	VPBLENDVB Y15, Y14, Y3, Y3
+	VPBLENDVB Y15, Y14, Y2, Y2
+	VPBLENDVB Y15, Y14, Y0, Y0
+	VPBLENDVB Y15, Y14, Y1, Y1
+	VPBLENDVB Y15, Y14, Y6, Y6
+	VPBLENDVB Y15, Y14, Y4, Y4
+	VPBLENDVB Y15, Y14, Y10, Y10
+
+	TRANSPOSE(Y9, Y3, Y2, Y0, Y1, Y6, Y4, Y10, Y5, Y7, Y8, Y11, Y12, Y13, Y14, Y15)
+
+	// Vertical 1-D IDCT. Y5, Y7, Y8, Y11, Y12, Y13, Y14, and Y15 hold rows 0 through 7.
+	VMOVD CX, X9
+	VPBROADCASTD X9, Y9
+	VMOVQ BX, X10
+
+	// Prescale. y0 = Y5, y1 = Y12, y2 = Y14, y3 = Y8, y4 = Y7, y5 = Y15, y6 = Y13, y7 = Y11
+	VPSLLD $8, Y5, Y5
+	VPADDD Y9, Y5, Y5
+	VPSLLD $8, Y12, Y12
+
+	// Stage 1. y8 = Y0
+	VPADDD Y15, Y7, Y0
+	VPMULLD w7<>(SB), Y0, Y0
+	VPADDD four<>(SB), Y0, Y0
+	VPMULLD w1mw7<>(SB), Y7, Y1
+	VPADDD Y1, Y0, Y7
+	VPSRAD $3, Y7, Y7
+	VPMULLD w1pw7<>(SB), Y15, Y1
+	VPSUBD Y1, Y0, Y15
+	VPSRAD $3, Y15, Y15
+	VPADDD Y11, Y13, Y0
+	VPMULLD w3<>(SB), Y0, Y0
+	VPADDD four<>(SB), Y0, Y0
+	VPMULLD w3mw5<>(SB), Y13, Y1
+	VPSUBD Y1, Y0, Y13
+	VPSRAD $3, Y13, Y13
+	VPMULLD w3pw5<>(SB), Y11, Y1
+	VPSUBD Y1, Y0, Y11
+	VPSRAD $3, Y11, Y11
+
+	// Stage 2.
+	VPADDD Y12, Y5, Y0
+	VPSUBD Y12, Y5, Y5
+	VPADDD Y14, Y8, Y12
+	VPMULLD w6<>(SB), Y12, Y12
+	VPADDD four<>(SB), Y12, Y12
+	VPMULLD w2pw6<>(SB), Y14, Y1
+	VPSUBD Y1, Y12, Y14
+	VPSRAD $3, Y14, Y14
+	VPMULLD w2mw6<>(SB), Y8, Y1
+	VPADDD Y1, Y12, Y8
+	VPSRAD $3, Y8, Y8
+	VPADDD Y13, Y7, Y12
+	VPSUBD Y13, Y7, Y7
+	VPADDD Y11, Y15, Y13
+	VPSUBD Y11, Y15, Y15
+
+	// Stage 3.
+	VPADDD Y8, Y0, Y11
+	VPSUBD Y8, Y0, Y0
+	VPADDD Y14, Y5, Y8
+	VPSUBD Y14, Y5, Y5
+	VPADDD Y15, Y7, Y14
+	VPMULLD r2<>(SB), Y14, Y14
+	VPADDD oneTwentyEight<>(SB), Y14, Y14
+	VPSRAD $8, Y14, Y14
+	VPSUBD Y15, Y7, Y7
+	VPMULLD r2<>(SB), Y7, Y7
+	VPADDD oneTwentyEight<>(SB), Y7, Y7
+	VPSRAD $8, Y7, Y7
+
+	// Stage 4.
+	VPADDD Y12, Y11, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 0(AX)
+	VPSUBD Y12, Y11, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 224(AX)
+	VPADDD Y14, Y8, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 32(AX)
+	VPSUBD Y14, Y8, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 192(AX)
+	VPADDD Y7, Y5, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 64(AX)
+	VPSUBD Y7, Y5, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 160(AX)
+	VPADDD Y13, Y0, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 96(AX)
+	VPSUBD Y13, Y0, Y1
+	VPSRAD X10, Y1, Y1
+	VMOVDQU Y1, 128(AX)
+
+	VZEROUPPER
+	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
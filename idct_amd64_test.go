@@ -0,0 +1,99 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+package prores
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDCTAVX2(t *testing.T) {
+	if !useAVX2 {
+		t.Skip("the CPU doesn't support AVX2")
+	}
+
+	check := func(t *testing.T, src block) {
+		for _, extraBits := range []uint{0, 1, 2} {
+			expected := src
+			genericIDCT(&expected, extraBits)
+			actual := src
+			idctAVX2(&actual, int32(8192)>>extraBits, uint64(14-extraBits))
+			require.Equal(t, expected, actual, "input: %v, extra bits: %v", src, extraBits)
+		}
+	}
+
+	t.Run("Basis", func(t *testing.T) {
+		// Every coefficient alone, at every magnitude, including ones that overflow.
+		for i := 0; i < blockSize; i++ {
+			for bit := uint(0); bit < 32; bit++ {
+				for _, v := range []int32{1 << bit, -1 << bit, 1<<bit - 1, -(1<<bit - 1)} {
+					var src block
+					src[i] = v
+					check(t, src)
+					src[0] = 4096
+					check(t, src)
+				}
+			}
+		}
+	})
+
+	t.Run("Random", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for _, tc := range []struct {
+			Name    string
+			Sparse  bool
+			Extreme bool
+		}{
+			// Dequantized coefficients from a valid bitstream.
+			{"Dense", false, false},
+			// Most rows have no AC components, which is the horizontal pass's shortcut.
+			{"Sparse", true, false},
+			// Anything at all, which overflows.
+			{"Extreme", false, true},
+			{"SparseExtreme", true, true},
+		} {
+			t.Run(tc.Name, func(t *testing.T) {
+				for i := 0; i < 20000; i++ {
+					var src block
+					for j := range src {
+						if tc.Sparse && rng.Intn(16) != 0 {
+							continue
+						}
+						if tc.Extreme {
+							src[j] = int32(rng.Uint32())
+						} else {
+							src[j] = int32(rng.Intn(1<<16)) - 1<<15
+						}
+					}
+					check(t, src)
+				}
+			})
+		}
+	})
+}
+
+func BenchmarkIDCT(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	var src block
+	for i := range src {
+		src[i] = int32(rng.Intn(1<<11)) - 1<<10
+	}
+
+	for _, bc := range []struct {
+		Name string
+		IDCT func(*block, uint)
+	}{
+		{"Generic", genericIDCT},
+		{"Dispatch", idctWithExtraBits},
+	} {
+		b.Run(bc.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				dst := src
+				bc.IDCT(&dst, 0)
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !amd64 || purego
+// +build !amd64 purego
+
+package prores
+
+// idctWithExtraBits is like idct, but scales the output up by 2^extraBits, keeping that many bits of
+// the fractional component that idct would round away. This is used for output with more than 10 bits
+// of precision.
+func idctWithExtraBits(src *block, extraBits uint) {
+	genericIDCT(src, extraBits)
+}
@@ -0,0 +1,152 @@
+package prores
+
+// This is a Go translation of the ProRes path of FFmpeg's simple_idct (ff_prores_idct_10 and
+// ff_prores_idct_12 in libavcodec), which is what FFmpeg's prores decoder uses. Unlike idct, it works
+// on 16-bit intermediates like the original does, including the way values wrap when the input is out
+// of range.
+
+// The constants for one bit depth. wN is cos(N*pi/16) scaled by 2^14*sqrt(2) for 10-bit output and
+// 2^15*sqrt(2) for 12-bit output.
+type integerIDCTConstants struct {
+	w1, w2, w3, w4, w5, w6, w7 int32
+
+	// The shifts at the end of each pass. rowShift includes the row pass's extra shift.
+	rowShift, colShift uint
+
+	// The minimum and maximum output values.
+	min, max int16
+}
+
+var integerIDCT10 = integerIDCTConstants{
+	w1: 22725,
+	w2: 21407,
+	w3: 19265,
+	w4: 16384,
+	w5: 12873,
+	w6: 8867,
+	w7: 4520,
+
+	rowShift: 13 + 2,
+	colShift: 18,
+
+	// Values outside of this range are reserved in 10-bit video.
+	min: 4,
+	max: 1<<10 - 5,
+}
+
+var integerIDCT12 = integerIDCTConstants{
+	w1: 45451,
+	w2: 42813,
+	w3: 38531,
+	w4: 32767,
+	w5: 25746,
+	w6: 17734,
+	w7: 9041,
+
+	rowShift: 16,
+	colShift: 17,
+
+	min: 4,
+	max: 1<<12 - 5,
+}
+
+// Dequantizes and transforms a block of coefficients. mat is the scaled quantization matrix. The
+// output is already clipped to the range given by c.
+func integerIDCT(dst *[64]int16, quantized *[64]int16, mat *[64]int32, c *integerIDCTConstants) {
+	for i := range dst {
+		dst[i] = quantized[i] * int16(mat[i])
+	}
+
+	for y := 0; y < 8; y++ {
+		integerIDCTRow(dst[y*8:y*8+8], c)
+	}
+
+	// Bias the DC components of the columns so that the output is centered on the middle of the
+	// range.
+	for x := 0; x < 8; x++ {
+		dst[x] += 8192
+	}
+
+	for x := 0; x < 8; x++ {
+		integerIDCTColumn(dst, x, c)
+	}
+
+	for i, v := range dst {
+		if v < c.min {
+			dst[i] = c.min
+		} else if v > c.max {
+			dst[i] = c.max
+		}
+	}
+}
+
+func integerIDCTRow(row []int16, c *integerIDCTConstants) {
+	_ = row[7]
+
+	// If all the AC components are zero, then the IDCT is trivial. For 12-bit output, this isn't
+	// quite what the general case would produce, but it's what FFmpeg does.
+	if row[1]|row[2]|row[3]|row[4]|row[5]|row[6]|row[7] == 0 {
+		dc := int16((int32(row[0]) + 1) >> 1)
+		for i := range row {
+			row[i] = dc
+		}
+		return
+	}
+
+	r0, r1, r2, r3 := int32(row[0]), int32(row[1]), int32(row[2]), int32(row[3])
+	r4, r5, r6, r7 := int32(row[4]), int32(row[5]), int32(row[6]), int32(row[7])
+
+	a0 := c.w4*r0 + 1<<(c.rowShift-1)
+	a1 := a0
+	a2 := a0
+	a3 := a0
+
+	a0 += c.w2*r2 + c.w4*r4 + c.w6*r6
+	a1 += c.w6*r2 - c.w4*r4 - c.w2*r6
+	a2 += -c.w6*r2 - c.w4*r4 + c.w2*r6
+	a3 += -c.w2*r2 + c.w4*r4 - c.w6*r6
+
+	b0 := c.w1*r1 + c.w3*r3 + c.w5*r5 + c.w7*r7
+	b1 := c.w3*r1 - c.w7*r3 - c.w1*r5 - c.w5*r7
+	b2 := c.w5*r1 - c.w1*r3 + c.w7*r5 + c.w3*r7
+	b3 := c.w7*r1 - c.w5*r3 + c.w3*r5 - c.w1*r7
+
+	row[0] = int16((a0 + b0) >> c.rowShift)
+	row[1] = int16((a1 + b1) >> c.rowShift)
+	row[2] = int16((a2 + b2) >> c.rowShift)
+	row[3] = int16((a3 + b3) >> c.rowShift)
+	row[4] = int16((a3 - b3) >> c.rowShift)
+	row[5] = int16((a2 - b2) >> c.rowShift)
+	row[6] = int16((a1 - b1) >> c.rowShift)
+	row[7] = int16((a0 - b0) >> c.rowShift)
+}
+
+func integerIDCTColumn(src *[64]int16, x int, c *integerIDCTConstants) {
+	r0, r1, r2, r3 := int32(src[8*0+x]), int32(src[8*1+x]), int32(src[8*2+x]), int32(src[8*3+x])
+	r4, r5, r6, r7 := int32(src[8*4+x]), int32(src[8*5+x]), int32(src[8*6+x]), int32(src[8*7+x])
+
+	// The rounding term is added before the multiplication, so it's truncated.
+	a0 := c.w4 * (r0 + (1<<(c.colShift-1))/c.w4)
+	a1 := a0
+	a2 := a0
+	a3 := a0
+
+	a0 += c.w2*r2 + c.w4*r4 + c.w6*r6
+	a1 += c.w6*r2 - c.w4*r4 - c.w2*r6
+	a2 += -c.w6*r2 - c.w4*r4 + c.w2*r6
+	a3 += -c.w2*r2 + c.w4*r4 - c.w6*r6
+
+	b0 := c.w1*r1 + c.w3*r3 + c.w5*r5 + c.w7*r7
+	b1 := c.w3*r1 - c.w7*r3 - c.w1*r5 - c.w5*r7
+	b2 := c.w5*r1 - c.w1*r3 + c.w7*r5 + c.w3*r7
+	b3 := c.w7*r1 - c.w5*r3 + c.w3*r5 - c.w1*r7
+
+	src[8*0+x] = int16((a0 + b0) >> c.colShift)
+	src[8*1+x] = int16((a1 + b1) >> c.colShift)
+	src[8*2+x] = int16((a2 + b2) >> c.colShift)
+	src[8*3+x] = int16((a3 + b3) >> c.colShift)
+	src[8*4+x] = int16((a3 - b3) >> c.colShift)
+	src[8*5+x] = int16((a2 - b2) >> c.colShift)
+	src[8*6+x] = int16((a1 - b1) >> c.colShift)
+	src[8*7+x] = int16((a0 - b0) >> c.colShift)
+}
@@ -0,0 +1,60 @@
+package prores
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegerIDCT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, tc := range []struct {
+		BitDepth  int
+		Constants *integerIDCTConstants
+		MaxError  float64
+	}{
+		{10, &integerIDCT10, 1},
+		// The 12-bit transform keeps fewer fractional bits between passes.
+		{12, &integerIDCT12, 2},
+	} {
+		scale := float64(int(1) << uint(tc.BitDepth-10))
+		for i := 0; i < 1000; i++ {
+			var quantized [64]int16
+			var mat [64]int32
+			for j := range quantized {
+				mat[j] = int32(4 + rng.Intn(60))
+				if j == 0 || rng.Intn(4) == 0 {
+					quantized[j] = int16(rng.Intn(20) - 10)
+				}
+			}
+
+			var samples [64]int16
+			integerIDCT(&samples, &quantized, &mat, tc.Constants)
+
+			// Compare against a floating point IDCT with the same scale.
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					sum := 0.0
+					for v := 0; v < 8; v++ {
+						for u := 0; u < 8; u++ {
+							c := float64(int32(quantized[v*8+u]) * mat[v*8+u])
+							if u == 0 {
+								c /= math.Sqrt2
+							}
+							if v == 0 {
+								c /= math.Sqrt2
+							}
+							sum += c * math.Cos(float64((2*x+1)*u)*math.Pi/16) * math.Cos(float64((2*y+1)*v)*math.Pi/16)
+						}
+					}
+					expected := scale * (512 + sum/16)
+					expected = math.Max(float64(tc.Constants.min), math.Min(float64(tc.Constants.max), expected))
+					assert.InDelta(t, expected, float64(samples[y*8+x]), tc.MaxError)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package prores
+
+import (
+	"math"
+)
+
+// The bases of the reduced inverse DCTs, indexed by scale shift, output sample, and coefficient.
+// They're scaled by 2^12, and include a factor of 1/2 so that the 2-D transform of the low n by n
+// coefficients of a block has the same DC gain as the full transform, which makes each output
+// sample approximately the average of the n by n samples that it replaces.
+var reducedIDCTBases = [3][4][4]int64{
+	1: newReducedIDCTBasis(4),
+	2: newReducedIDCTBasis(2),
+}
+
+func newReducedIDCTBasis(n int) [4][4]int64 {
+	var ret [4][4]int64
+	for x := 0; x < n; x++ {
+		for u := 0; u < n; u++ {
+			c := 0.5 * math.Cos(float64((2*x+1)*u)*math.Pi/float64(2*n))
+			if u == 0 {
+				c /= math.Sqrt2
+			}
+			ret[x][u] = int64(math.Round(c * (1 << 12)))
+		}
+	}
+	return ret
+}
+
+// Dequantizes a block of coefficients and transforms only its low frequencies, producing an n by n
+// block of samples where n is 8 >> shift. shift must be between 1 and 3. For a shift of 3, only the
+// DC coefficient is used. Like decodeBlock16, the output is scaled up by 2^extraBits, but it isn't
+// clamped.
+func reducedIDCT(dst *[64]int32, quantized *[64]int16, mat *[64]int32, shift, extraBits uint) {
+	if shift == 3 {
+		dc := (int32(quantized[0]) * mat[0]) >> 2
+		dst[0] = 512<<extraBits + (dc<<extraBits+4)>>3
+		return
+	}
+
+	n := BlockWidth >> shift
+	basis := &reducedIDCTBases[shift]
+
+	// Horizontal 1-D IDCT.
+	var tmp [16]int64
+	for v := 0; v < n; v++ {
+		var dequantized [4]int64
+		for u := 0; u < n; u++ {
+			dequantized[u] = int64((int32(quantized[v*8+u]) * mat[v*8+u]) >> 2)
+		}
+		for x := 0; x < n; x++ {
+			var sum int64
+			for u := 0; u < n; u++ {
+				sum += basis[x][u] * dequantized[u]
+			}
+			tmp[v*n+x] = sum
+		}
+	}
+
+	// Vertical 1-D IDCT.
+	outputShift := 24 - extraBits
+	rounding := int64(1) << (outputShift - 1)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			var sum int64
+			for v := 0; v < n; v++ {
+				sum += basis[y][v] * tmp[v*n+x]
+			}
+			dst[y*n+x] = 512<<extraBits + int32((sum+rounding)>>outputShift)
+		}
+	}
+}
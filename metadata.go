@@ -0,0 +1,186 @@
+package prores
+
+import "fmt"
+
+type AspectRatio byte
+
+const (
+	AspectRatioUnknown AspectRatio = 0
+	AspectRatioSquare  AspectRatio = 1
+	AspectRatio4x3     AspectRatio = 2
+	AspectRatio16x9    AspectRatio = 3
+)
+
+func (r AspectRatio) String() string {
+	switch r {
+	case AspectRatioUnknown:
+		return "unknown"
+	case AspectRatioSquare:
+		return "1:1"
+	case AspectRatio4x3:
+		return "4:3"
+	case AspectRatio16x9:
+		return "16:9"
+	}
+	return fmt.Sprintf("AspectRatio(%d)", byte(r))
+}
+
+type FrameRate byte
+
+const (
+	FrameRateUnknown FrameRate = 0
+	FrameRate23_98   FrameRate = 1
+	FrameRate24      FrameRate = 2
+	FrameRate25      FrameRate = 3
+	FrameRate29_97   FrameRate = 4
+	FrameRate30      FrameRate = 5
+	FrameRate50      FrameRate = 6
+	FrameRate59_94   FrameRate = 7
+	FrameRate60      FrameRate = 8
+	FrameRate100     FrameRate = 9
+	FrameRate119_88  FrameRate = 10
+	FrameRate120     FrameRate = 11
+)
+
+var frameRates = [...]struct {
+	Numerator   int
+	Denominator int
+	Name        string
+}{
+	FrameRate23_98:  {24000, 1001, "23.98"},
+	FrameRate24:     {24, 1, "24"},
+	FrameRate25:     {25, 1, "25"},
+	FrameRate29_97:  {30000, 1001, "29.97"},
+	FrameRate30:     {30, 1, "30"},
+	FrameRate50:     {50, 1, "50"},
+	FrameRate59_94:  {60000, 1001, "59.94"},
+	FrameRate60:     {60, 1, "60"},
+	FrameRate100:    {100, 1, "100"},
+	FrameRate119_88: {120000, 1001, "119.88"},
+	FrameRate120:    {120, 1, "120"},
+}
+
+// Returns the frame rate as a fraction. If the frame rate is unknown, 0/0 is returned.
+func (r FrameRate) Rate() (numerator, denominator int) {
+	if int(r) < len(frameRates) {
+		return frameRates[r].Numerator, frameRates[r].Denominator
+	}
+	return 0, 0
+}
+
+func (r FrameRate) String() string {
+	if r == FrameRateUnknown {
+		return "unknown"
+	} else if int(r) < len(frameRates) {
+		return frameRates[r].Name
+	}
+	return fmt.Sprintf("FrameRate(%d)", byte(r))
+}
+
+// ColorPrimaries uses the code points defined by ISO/IEC 23001-8.
+type ColorPrimaries byte
+
+const (
+	ColorPrimariesUnknown     ColorPrimaries = 0
+	ColorPrimariesBT709       ColorPrimaries = 1
+	ColorPrimariesUnspecified ColorPrimaries = 2
+	ColorPrimariesBT470BG     ColorPrimaries = 5
+	ColorPrimariesSMPTE170M   ColorPrimaries = 6
+	ColorPrimariesBT2020      ColorPrimaries = 9
+	ColorPrimariesSMPTE428    ColorPrimaries = 10
+	ColorPrimariesDCIP3       ColorPrimaries = 11
+	ColorPrimariesP3D65       ColorPrimaries = 12
+)
+
+func (p ColorPrimaries) String() string {
+	switch p {
+	case ColorPrimariesUnknown:
+		return "unknown"
+	case ColorPrimariesBT709:
+		return "BT.709"
+	case ColorPrimariesUnspecified:
+		return "unspecified"
+	case ColorPrimariesBT470BG:
+		return "BT.470 BG"
+	case ColorPrimariesSMPTE170M:
+		return "SMPTE 170M"
+	case ColorPrimariesBT2020:
+		return "BT.2020"
+	case ColorPrimariesSMPTE428:
+		return "SMPTE ST 428-1"
+	case ColorPrimariesDCIP3:
+		return "DCI-P3"
+	case ColorPrimariesP3D65:
+		return "P3-D65"
+	}
+	return fmt.Sprintf("ColorPrimaries(%d)", byte(p))
+}
+
+// TransferCharacteristic uses the code points defined by ISO/IEC 23001-8.
+type TransferCharacteristic byte
+
+const (
+	TransferCharacteristicUnknown     TransferCharacteristic = 0
+	TransferCharacteristicBT709       TransferCharacteristic = 1
+	TransferCharacteristicUnspecified TransferCharacteristic = 2
+	TransferCharacteristicSMPTE240M   TransferCharacteristic = 7
+	TransferCharacteristicSMPTE2084   TransferCharacteristic = 16
+	TransferCharacteristicHLG         TransferCharacteristic = 18
+)
+
+// Returns true if the transfer characteristic is one of the high dynamic range curves (PQ or HLG).
+func (c TransferCharacteristic) IsHDR() bool {
+	return c == TransferCharacteristicSMPTE2084 || c == TransferCharacteristicHLG
+}
+
+func (c TransferCharacteristic) String() string {
+	switch c {
+	case TransferCharacteristicUnknown:
+		return "unknown"
+	case TransferCharacteristicBT709:
+		return "BT.709"
+	case TransferCharacteristicUnspecified:
+		return "unspecified"
+	case TransferCharacteristicSMPTE240M:
+		return "SMPTE 240M"
+	case TransferCharacteristicSMPTE2084:
+		return "SMPTE ST 2084 (PQ)"
+	case TransferCharacteristicHLG:
+		return "ARIB STD-B67 (HLG)"
+	}
+	return fmt.Sprintf("TransferCharacteristic(%d)", byte(c))
+}
+
+// MatrixCoefficients uses the code points defined by ISO/IEC 23001-8.
+type MatrixCoefficients byte
+
+const (
+	MatrixCoefficientsUnknown     MatrixCoefficients = 0
+	MatrixCoefficientsBT709       MatrixCoefficients = 1
+	MatrixCoefficientsUnspecified MatrixCoefficients = 2
+	MatrixCoefficientsSMPTE170M   MatrixCoefficients = 6
+	MatrixCoefficientsSMPTE240M   MatrixCoefficients = 7
+	MatrixCoefficientsBT2020NCL   MatrixCoefficients = 9
+)
+
+func (c MatrixCoefficients) String() string {
+	switch c {
+	case MatrixCoefficientsUnknown:
+		return "unknown"
+	case MatrixCoefficientsBT709:
+		return "BT.709"
+	case MatrixCoefficientsUnspecified:
+		return "unspecified"
+	case MatrixCoefficientsSMPTE170M:
+		return "SMPTE 170M"
+	case MatrixCoefficientsSMPTE240M:
+		return "SMPTE 240M"
+	case MatrixCoefficientsBT2020NCL:
+		return "BT.2020 non-constant luminance"
+	}
+	return fmt.Sprintf("MatrixCoefficients(%d)", byte(c))
+}
+
+// SourcePixelFormat describes the pixel format that the encoder's input was in. Its values aren't
+// publicly documented, so it's exposed as-is.
+type SourcePixelFormat byte
@@ -0,0 +1,37 @@
+package prores
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrameRate(t *testing.T) {
+	n, d := FrameRate29_97.Rate()
+	assert.Equal(t, 30000, n)
+	assert.Equal(t, 1001, d)
+	assert.Equal(t, "29.97", FrameRate29_97.String())
+
+	n, d = FrameRateUnknown.Rate()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, d)
+	assert.Equal(t, "unknown", FrameRateUnknown.String())
+
+	n, d = FrameRate(15).Rate()
+	assert.Equal(t, 0, n)
+	assert.Equal(t, "FrameRate(15)", FrameRate(15).String())
+}
+
+func TestMetadataStrings(t *testing.T) {
+	assert.Equal(t, "16:9", AspectRatio16x9.String())
+	assert.Equal(t, "BT.2020", ColorPrimariesBT2020.String())
+	assert.Equal(t, "ColorPrimaries(200)", ColorPrimaries(200).String())
+	assert.Equal(t, "SMPTE ST 2084 (PQ)", TransferCharacteristicSMPTE2084.String())
+	assert.Equal(t, "BT.709", MatrixCoefficientsBT709.String())
+}
+
+func TestTransferCharacteristic_IsHDR(t *testing.T) {
+	assert.True(t, TransferCharacteristicSMPTE2084.IsHDR())
+	assert.True(t, TransferCharacteristicHLG.IsHDR())
+	assert.False(t, TransferCharacteristicBT709.IsHDR())
+}
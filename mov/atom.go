@@ -0,0 +1,102 @@
+package mov
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// An atom is a QuickTime atom (an ISO base media file format box) whose payload is at
+// [Offset, Offset+Size) of the underlying reader. Its header immediately precedes the payload.
+type atom struct {
+	Type       string
+	Offset     int64
+	Size       int64
+	HeaderSize int64
+}
+
+// Returns the offset of the atom's header.
+func (a *atom) start() int64 {
+	return a.Offset - a.HeaderSize
+}
+
+// Returns the offset immediately following the atom.
+func (a *atom) end() int64 {
+	return a.Offset + a.Size
+}
+
+// Reads the atoms contained in [offset, offset+size).
+func readAtoms(r io.ReaderAt, offset, size int64) ([]atom, error) {
+	var ret []atom
+	end := offset + size
+	for offset < end {
+		if end-offset < 8 {
+			return nil, fmt.Errorf("truncated atom header at offset %v", offset)
+		}
+
+		var buf [16]byte
+		if _, err := r.ReadAt(buf[:8], offset); err != nil {
+			return nil, err
+		}
+
+		atomSize := int64(binary.BigEndian.Uint32(buf[:]))
+		headerSize := int64(8)
+		switch atomSize {
+		case 0:
+			// The atom extends to the end of its container.
+			atomSize = end - offset
+		case 1:
+			if end-offset < 16 {
+				return nil, fmt.Errorf("truncated atom header at offset %v", offset)
+			}
+			if _, err := r.ReadAt(buf[8:], offset+8); err != nil {
+				return nil, err
+			}
+			largeSize := binary.BigEndian.Uint64(buf[8:])
+			if largeSize > uint64(end-offset) {
+				return nil, fmt.Errorf("atom at offset %v exceeds its container", offset)
+			}
+			atomSize = int64(largeSize)
+			headerSize = 16
+		}
+
+		if atomSize < headerSize {
+			return nil, fmt.Errorf("invalid atom size at offset %v", offset)
+		} else if atomSize > end-offset {
+			return nil, fmt.Errorf("atom at offset %v exceeds its container", offset)
+		}
+
+		ret = append(ret, atom{
+			Type:       string(buf[4:8]),
+			Offset:     offset + headerSize,
+			Size:       atomSize - headerSize,
+			HeaderSize: headerSize,
+		})
+		offset += atomSize
+	}
+	return ret, nil
+}
+
+// Returns the first atom of the given type, or nil if there is none.
+func findAtom(atoms []atom, atomType string) *atom {
+	for i := range atoms {
+		if atoms[i].Type == atomType {
+			return &atoms[i]
+		}
+	}
+	return nil
+}
+
+// Reads the entire payload of a leaf atom.
+func (a *atom) read(r io.ReaderAt) ([]byte, error) {
+	buf := make([]byte, a.Size)
+	if n, err := r.ReadAt(buf, a.Offset); n < len(buf) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Reads the children of a container atom.
+func (a *atom) children(r io.ReaderAt) ([]atom, error) {
+	return readAtoms(r, a.Offset, a.Size)
+}
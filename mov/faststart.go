@@ -0,0 +1,192 @@
+package mov
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Rewrites a movie so that its moov atom precedes the media data, allowing playback to begin
+// before the whole file is downloaded. The chunk offsets are adjusted accordingly, and stco atoms
+// are upgraded to co64 atoms if the adjusted offsets don't fit in 32 bits. If the moov atom already
+// precedes the media data, the movie is copied as-is.
+func Faststart(dst io.Writer, src io.ReaderAt, size int64) error {
+	atoms, err := readAtoms(src, 0, size)
+	if err != nil {
+		return err
+	}
+
+	moovIndex, mdatIndex := -1, -1
+	for i, a := range atoms {
+		if a.Type == "moov" && moovIndex < 0 {
+			moovIndex = i
+		} else if a.Type == "mdat" && mdatIndex < 0 {
+			mdatIndex = i
+		}
+	}
+	if moovIndex < 0 {
+		return fmt.Errorf("moov atom not found")
+	} else if mdatIndex < 0 || moovIndex < mdatIndex {
+		_, err := io.Copy(dst, io.NewSectionReader(src, 0, size))
+		return err
+	}
+
+	moovAtom := atoms[moovIndex]
+	moov := make([]byte, moovAtom.end()-moovAtom.start())
+	if n, err := src.ReadAt(moov, moovAtom.start()); n < len(moov) {
+		return fmt.Errorf("unable to read moov atom: %w", err)
+	}
+
+	// Everything from the first mdat atom up to the moov atom moves back by the size of the moov
+	// atom. Everything after the moov atom stays where it is.
+	shiftStart, shiftEnd := atoms[mdatIndex].start(), moovAtom.start()
+	shift := int64(len(moov))
+	relocate := func(offset uint64) uint64 {
+		if offset >= uint64(shiftStart) && offset < uint64(shiftEnd) {
+			return offset + uint64(shift)
+		}
+		return offset
+	}
+	shifted := append([]byte(nil), moov...)
+	err = shiftChunkOffsets(shifted, moovAtom.HeaderSize, relocate)
+	if errors.Is(err, errChunkOffsetOverflow) {
+		// Switching to 64-bit offsets makes the moov atom larger, which moves the media data back
+		// even further. But co64 atoms can't overflow, so one more pass is enough.
+		if shifted, err = upgradeChunkOffsets(moov, moovAtom.HeaderSize); err != nil {
+			return err
+		}
+		shift = int64(len(shifted))
+		err = shiftChunkOffsets(shifted, moovAtom.HeaderSize, relocate)
+	}
+	if err != nil {
+		return err
+	}
+	moov = shifted
+
+	copyAtom := func(a *atom) error {
+		_, err := io.Copy(dst, io.NewSectionReader(src, a.start(), a.end()-a.start()))
+		return err
+	}
+	for i := range atoms[:mdatIndex] {
+		if err := copyAtom(&atoms[i]); err != nil {
+			return err
+		}
+	}
+	if _, err := dst.Write(moov); err != nil {
+		return err
+	}
+	for i := mdatIndex; i < len(atoms); i++ {
+		if i == moovIndex {
+			continue
+		}
+		if err := copyAtom(&atoms[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errChunkOffsetOverflow = errors.New("chunk offset exceeds 32 bits")
+
+// Applies f to every chunk offset in the stco and co64 atoms of the given serialized moov atom.
+func shiftChunkOffsets(moov []byte, headerSize int64, f func(uint64) uint64) error {
+	r := bytes.NewReader(moov)
+
+	var visit func(offset, size int64) error
+	visit = func(offset, size int64) error {
+		children, err := readAtoms(r, offset, size)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			payload := moov[child.Offset:child.end()]
+			switch child.Type {
+			case "trak", "mdia", "minf", "stbl":
+				if err := visit(child.Offset, child.Size); err != nil {
+					return err
+				}
+			case "stco":
+				entries, count, err := readTable(r, []atom{child}, "stco", 4)
+				if err != nil {
+					return err
+				}
+				for i := 0; i < count; i++ {
+					offset := f(uint64(binary.BigEndian.Uint32(entries[i*4:])))
+					if offset > math.MaxUint32 {
+						return errChunkOffsetOverflow
+					}
+					binary.BigEndian.PutUint32(payload[8+i*4:], uint32(offset))
+				}
+			case "co64":
+				entries, count, err := readTable(r, []atom{child}, "co64", 8)
+				if err != nil {
+					return err
+				}
+				for i := 0; i < count; i++ {
+					binary.BigEndian.PutUint64(payload[8+i*8:], f(binary.BigEndian.Uint64(entries[i*8:])))
+				}
+			}
+		}
+		return nil
+	}
+	return visit(headerSize, int64(len(moov))-headerSize)
+}
+
+// Returns a copy of the given serialized moov atom with its stco atoms replaced by co64 atoms. The
+// atoms that contain them grow accordingly.
+func upgradeChunkOffsets(moov []byte, headerSize int64) ([]byte, error) {
+	r := bytes.NewReader(moov)
+
+	var rewrite func(a atom) ([]byte, error)
+	rewrite = func(a atom) ([]byte, error) {
+		var payload []byte
+		switch a.Type {
+		case "moov", "trak", "mdia", "minf", "stbl":
+			children, err := readAtoms(r, a.Offset, a.Size)
+			if err != nil {
+				return nil, err
+			}
+			for _, child := range children {
+				b, err := rewrite(child)
+				if err != nil {
+					return nil, err
+				}
+				payload = append(payload, b...)
+			}
+		case "stco":
+			entries, count, err := readTable(r, []atom{a}, "stco", 4)
+			if err != nil {
+				return nil, err
+			}
+			a.Type = "co64"
+			payload = append(payload, moov[a.Offset:a.Offset+8]...)
+			for i := 0; i < count; i++ {
+				payload = binary.BigEndian.AppendUint64(payload, uint64(binary.BigEndian.Uint32(entries[i*4:])))
+			}
+		default:
+			return moov[a.start():a.end()], nil
+		}
+
+		size := uint64(a.HeaderSize) + uint64(len(payload))
+		if a.HeaderSize == 16 {
+			header := binary.BigEndian.AppendUint32(nil, 1)
+			header = append(header, a.Type...)
+			header = binary.BigEndian.AppendUint64(header, size)
+			return append(header, payload...), nil
+		} else if size > math.MaxUint32 {
+			return nil, fmt.Errorf("%v atom is too large", a.Type)
+		}
+		header := binary.BigEndian.AppendUint32(nil, uint32(size))
+		header = append(header, a.Type...)
+		return append(header, payload...), nil
+	}
+	return rewrite(atom{
+		Type:       "moov",
+		Offset:     headerSize,
+		Size:       int64(len(moov)) - headerSize,
+		HeaderSize: headerSize,
+	})
+}
@@ -0,0 +1,455 @@
+// Package mov reads and writes QuickTime movies containing ProRes video tracks.
+package mov
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	prores "github.com/theaaf/prores-go"
+)
+
+var proResFourCCs = map[string]bool{
+	"apco": true, // Proxy
+	"apcs": true, // LT
+	"apcn": true, // Standard
+	"apch": true, // HQ
+	"ap4h": true, // 4444
+	"ap4x": true, // 4444 XQ
+}
+
+// Returns true if fourCC is the sample description format of one of the ProRes profiles.
+func IsProRes(fourCC string) bool {
+	return proResFourCCs[fourCC]
+}
+
+// Reader provides access to the tracks of a QuickTime movie.
+type Reader struct {
+	// The number of movie time units per second.
+	Timescale uint32
+
+	// The duration of the movie in movie time units.
+	Duration uint64
+
+	Tracks []*Track
+}
+
+// Parses the movie's metadata. The samples themselves are only read on demand.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	atoms, err := readAtoms(r, 0, size)
+	if err != nil {
+		return nil, err
+	}
+
+	moov := findAtom(atoms, "moov")
+	if moov == nil {
+		return nil, fmt.Errorf("moov atom not found")
+	}
+	children, err := moov.children(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read moov atom: %w", err)
+	}
+
+	ret := &Reader{}
+	mvhd := findAtom(children, "mvhd")
+	if mvhd == nil {
+		return nil, fmt.Errorf("mvhd atom not found")
+	}
+	buf, err := mvhd.read(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read mvhd atom: %w", err)
+	}
+	if ret.Timescale, ret.Duration, err = parseTimescaleAndDuration(buf); err != nil {
+		return nil, fmt.Errorf("unable to parse mvhd atom: %w", err)
+	}
+
+	for _, child := range children {
+		if child.Type != "trak" {
+			continue
+		}
+		track, err := readTrack(r, size, &child)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read track %v: %w", len(ret.Tracks), err)
+		}
+		ret.Tracks = append(ret.Tracks, track)
+	}
+	return ret, nil
+}
+
+// Returns the tracks whose samples are ProRes frames.
+func (r *Reader) ProResTracks() []*Track {
+	var ret []*Track
+	for _, t := range r.Tracks {
+		if IsProRes(t.FourCC) {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// Track is a single track of a movie. Each of a ProRes track's samples is one frame that can be
+// passed directly to prores.DecodeFrame.
+type Track struct {
+	ID uint32
+
+	// The media handler type, such as "vide" or "soun".
+	HandlerType string
+
+	// The data format of the track's first sample description, such as "apch".
+	FourCC string
+
+	// For video tracks, the dimensions given by the sample description.
+	Width  int
+	Height int
+
+	// The number of media time units per second.
+	Timescale uint32
+
+	// The duration of the media in media time units.
+	Duration uint64
+
+	r       io.ReaderAt
+	samples []sample
+}
+
+type sample struct {
+	Offset int64
+	Size   int64
+
+	// The sample's decode time in media time units.
+	Time int64
+}
+
+// Returns the number of samples in the track.
+func (t *Track) NumSamples() int {
+	return len(t.samples)
+}
+
+// Returns a reader for the nth sample. ProRes frames in QuickTime movies are wrapped in an 8-byte
+// "icpf" container, which is excluded from the samples of ProRes tracks.
+func (t *Track) Sample(n int) (*io.SectionReader, error) {
+	if n < 0 || n >= len(t.samples) {
+		return nil, fmt.Errorf("sample %v out of range", n)
+	}
+	s := &t.samples[n]
+	sr := io.NewSectionReader(t.r, s.Offset, s.Size)
+	if !IsProRes(t.FourCC) {
+		return sr, nil
+	}
+	fr, err := prores.NewFrameReader(sr, s.Size)
+	if err != nil {
+		return nil, err
+	}
+	return fr.SectionReader, nil
+}
+
+// Returns the time at which the nth sample starts, rounded up to the nanosecond so that passing it
+// to SampleAtTime returns the same sample.
+func (t *Track) SampleTime(n int) (time.Duration, error) {
+	if n < 0 || n >= len(t.samples) {
+		return 0, fmt.Errorf("sample %v out of range", n)
+	}
+	return t.toDuration(t.samples[n].Time), nil
+}
+
+// Returns the index of the sample that is presented at the given time. Edit lists are ignored, so
+// the time is relative to the start of the track's media rather than the start of the movie.
+func (t *Track) SampleAtTime(d time.Duration) (int, error) {
+	if d < 0 || len(t.samples) == 0 {
+		return 0, fmt.Errorf("time %v out of range", d)
+	}
+	units := t.fromDuration(d)
+	if end := t.samples[len(t.samples)-1].Time + t.sampleDuration(len(t.samples)-1); units >= end {
+		return 0, fmt.Errorf("time %v out of range", d)
+	}
+	return sort.Search(len(t.samples), func(i int) bool {
+		return t.samples[i].Time > units
+	}) - 1, nil
+}
+
+func (t *Track) sampleDuration(n int) int64 {
+	if n+1 < len(t.samples) {
+		return t.samples[n+1].Time - t.samples[n].Time
+	}
+	if end := int64(t.Duration); end > t.samples[n].Time {
+		return end - t.samples[n].Time
+	}
+	return 1
+}
+
+func (t *Track) toDuration(units int64) time.Duration {
+	timescale := int64(t.Timescale)
+	return time.Duration(units/timescale)*time.Second + (time.Duration(units%timescale)*time.Second+time.Duration(timescale-1))/time.Duration(timescale)
+}
+
+func (t *Track) fromDuration(d time.Duration) int64 {
+	timescale := int64(t.Timescale)
+	return int64(d/time.Second)*timescale + int64(d%time.Second)*timescale/int64(time.Second)
+}
+
+// Parses the timescale and duration fields shared by mvhd and mdhd.
+func parseTimescaleAndDuration(buf []byte) (timescale uint32, duration uint64, err error) {
+	if len(buf) < 4 {
+		return 0, 0, fmt.Errorf("atom too short")
+	}
+	switch buf[0] {
+	case 0:
+		if len(buf) < 20 {
+			return 0, 0, fmt.Errorf("atom too short")
+		}
+		timescale = binary.BigEndian.Uint32(buf[12:])
+		duration = uint64(binary.BigEndian.Uint32(buf[16:]))
+	case 1:
+		if len(buf) < 32 {
+			return 0, 0, fmt.Errorf("atom too short")
+		}
+		timescale = binary.BigEndian.Uint32(buf[20:])
+		duration = binary.BigEndian.Uint64(buf[24:])
+	default:
+		return 0, 0, fmt.Errorf("unsupported version %v", buf[0])
+	}
+	if timescale == 0 {
+		return 0, 0, fmt.Errorf("timescale must not be zero")
+	}
+	return timescale, duration, nil
+}
+
+// Returns the children of the atom at the given path beneath parent.
+func findChildren(r io.ReaderAt, parent *atom, path ...string) ([]atom, error) {
+	children, err := parent.children(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, atomType := range path {
+		a := findAtom(children, atomType)
+		if a == nil {
+			return nil, fmt.Errorf("%v atom not found", atomType)
+		}
+		if children, err = a.children(r); err != nil {
+			return nil, fmt.Errorf("unable to read %v atom: %w", atomType, err)
+		}
+	}
+	return children, nil
+}
+
+// Reads the payload of the leaf atom of the given type.
+func readLeaf(r io.ReaderAt, atoms []atom, atomType string) ([]byte, error) {
+	a := findAtom(atoms, atomType)
+	if a == nil {
+		return nil, fmt.Errorf("%v atom not found", atomType)
+	}
+	buf, err := a.read(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v atom: %w", atomType, err)
+	}
+	return buf, nil
+}
+
+func readTrack(r io.ReaderAt, size int64, trak *atom) (*Track, error) {
+	ret := &Track{
+		r: r,
+	}
+
+	trakChildren, err := trak.children(r)
+	if err != nil {
+		return nil, err
+	}
+	tkhd, err := readLeaf(r, trakChildren, "tkhd")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(tkhd) >= 16 && tkhd[0] == 0:
+		ret.ID = binary.BigEndian.Uint32(tkhd[12:])
+	case len(tkhd) >= 24 && tkhd[0] == 1:
+		ret.ID = binary.BigEndian.Uint32(tkhd[20:])
+	default:
+		return nil, fmt.Errorf("invalid tkhd atom")
+	}
+
+	mdia, err := findChildren(r, trak, "mdia")
+	if err != nil {
+		return nil, err
+	}
+	mdhd, err := readLeaf(r, mdia, "mdhd")
+	if err != nil {
+		return nil, err
+	}
+	if ret.Timescale, ret.Duration, err = parseTimescaleAndDuration(mdhd); err != nil {
+		return nil, fmt.Errorf("unable to parse mdhd atom: %w", err)
+	}
+	hdlr, err := readLeaf(r, mdia, "hdlr")
+	if err != nil {
+		return nil, err
+	} else if len(hdlr) < 12 {
+		return nil, fmt.Errorf("invalid hdlr atom")
+	}
+	ret.HandlerType = string(hdlr[8:12])
+
+	stbl, err := findChildren(r, trak, "mdia", "minf", "stbl")
+	if err != nil {
+		return nil, err
+	}
+	if err := ret.parseSampleDescriptions(r, stbl); err != nil {
+		return nil, fmt.Errorf("unable to parse stsd atom: %w", err)
+	}
+	if err := ret.parseSampleTable(r, size, stbl); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (t *Track) parseSampleDescriptions(r io.ReaderAt, stbl []atom) error {
+	stsd, err := readLeaf(r, stbl, "stsd")
+	if err != nil {
+		return err
+	}
+	if len(stsd) < 8 {
+		return fmt.Errorf("atom too short")
+	} else if binary.BigEndian.Uint32(stsd[4:]) == 0 {
+		return nil
+	}
+
+	// Only the first sample description is used.
+	entry := stsd[8:]
+	if len(entry) < 16 {
+		return fmt.Errorf("sample description too short")
+	}
+	entrySize := binary.BigEndian.Uint32(entry)
+	if entrySize < 16 || uint64(entrySize) > uint64(len(entry)) {
+		return fmt.Errorf("invalid sample description size")
+	}
+	entry = entry[:entrySize]
+	t.FourCC = string(entry[4:8])
+
+	if t.HandlerType == "vide" && len(entry) >= 36 {
+		t.Width = int(binary.BigEndian.Uint16(entry[32:]))
+		t.Height = int(binary.BigEndian.Uint16(entry[34:]))
+	}
+	return nil
+}
+
+// Reads a table with a version/flags field and an entry count followed by fixed-size entries.
+func readTable(r io.ReaderAt, stbl []atom, atomType string, entrySize int) ([]byte, int, error) {
+	buf, err := readLeaf(r, stbl, atomType)
+	if err != nil {
+		return nil, 0, err
+	} else if len(buf) < 8 {
+		return nil, 0, fmt.Errorf("%v atom too short", atomType)
+	}
+	count := binary.BigEndian.Uint32(buf[4:])
+	if uint64(count)*uint64(entrySize) > uint64(len(buf)-8) {
+		return nil, 0, fmt.Errorf("%v atom too short for %v entries", atomType, count)
+	}
+	return buf[8:], int(count), nil
+}
+
+func (t *Track) parseSampleTable(r io.ReaderAt, size int64, stbl []atom) error {
+	// Sample sizes
+	stsz, err := readLeaf(r, stbl, "stsz")
+	if err != nil {
+		return err
+	} else if len(stsz) < 12 {
+		return fmt.Errorf("stsz atom too short")
+	}
+	uniformSize := binary.BigEndian.Uint32(stsz[4:])
+	sampleCount := binary.BigEndian.Uint32(stsz[8:])
+	if uniformSize == 0 && uint64(sampleCount)*4 > uint64(len(stsz)-12) {
+		return fmt.Errorf("stsz atom too short for %v entries", sampleCount)
+	} else if uniformSize != 0 && uint64(sampleCount)*uint64(uniformSize) > uint64(size) {
+		return fmt.Errorf("stsz atom's %v samples of %v bytes are larger than the file", sampleCount, uniformSize)
+	}
+	t.samples = make([]sample, sampleCount)
+	for i := range t.samples {
+		if uniformSize != 0 {
+			t.samples[i].Size = int64(uniformSize)
+		} else {
+			t.samples[i].Size = int64(binary.BigEndian.Uint32(stsz[12+i*4:]))
+		}
+	}
+
+	// Chunk offsets
+	var chunkOffsets []int64
+	if findAtom(stbl, "co64") != nil {
+		table, count, err := readTable(r, stbl, "co64", 8)
+		if err != nil {
+			return err
+		}
+		chunkOffsets = make([]int64, count)
+		for i := range chunkOffsets {
+			offset := binary.BigEndian.Uint64(table[i*8:])
+			if offset > uint64(size) {
+				return fmt.Errorf("chunk offset out of range")
+			}
+			chunkOffsets[i] = int64(offset)
+		}
+	} else {
+		table, count, err := readTable(r, stbl, "stco", 4)
+		if err != nil {
+			return err
+		}
+		chunkOffsets = make([]int64, count)
+		for i := range chunkOffsets {
+			chunkOffsets[i] = int64(binary.BigEndian.Uint32(table[i*4:]))
+		}
+	}
+
+	// Sample-to-chunk mapping
+	stsc, stscCount, err := readTable(r, stbl, "stsc", 12)
+	if err != nil {
+		return err
+	}
+	sampleIndex := 0
+	for entry := 0; entry < stscCount && sampleIndex < len(t.samples); entry++ {
+		firstChunk := int(binary.BigEndian.Uint32(stsc[entry*12:]))
+		samplesPerChunk := int(binary.BigEndian.Uint32(stsc[entry*12+4:]))
+		lastChunk := len(chunkOffsets)
+		if entry+1 < stscCount {
+			lastChunk = int(binary.BigEndian.Uint32(stsc[(entry+1)*12:])) - 1
+		}
+		if firstChunk < 1 || lastChunk > len(chunkOffsets) || lastChunk < firstChunk-1 {
+			return fmt.Errorf("invalid stsc entry %v", entry)
+		}
+		for chunk := firstChunk; chunk <= lastChunk && sampleIndex < len(t.samples); chunk++ {
+			offset := chunkOffsets[chunk-1]
+			for i := 0; i < samplesPerChunk && sampleIndex < len(t.samples); i++ {
+				s := &t.samples[sampleIndex]
+				if s.Size > size-offset {
+					return fmt.Errorf("sample %v out of bounds", sampleIndex)
+				}
+				s.Offset = offset
+				offset += s.Size
+				sampleIndex++
+			}
+		}
+	}
+	if sampleIndex < len(t.samples) {
+		return fmt.Errorf("chunks only contain %v of %v samples", sampleIndex, len(t.samples))
+	}
+
+	// Sample times
+	stts, sttsCount, err := readTable(r, stbl, "stts", 8)
+	if err != nil {
+		return err
+	}
+	sampleIndex = 0
+	var decodeTime int64
+	for entry := 0; entry < sttsCount && sampleIndex < len(t.samples); entry++ {
+		count := int(binary.BigEndian.Uint32(stts[entry*8:]))
+		delta := int64(binary.BigEndian.Uint32(stts[entry*8+4:]))
+		for i := 0; i < count && sampleIndex < len(t.samples); i++ {
+			t.samples[sampleIndex].Time = decodeTime
+			decodeTime += delta
+			sampleIndex++
+		}
+	}
+	if sampleIndex < len(t.samples) {
+		return fmt.Errorf("stts only contains %v of %v samples", sampleIndex, len(t.samples))
+	}
+	if uint64(decodeTime) > t.Duration {
+		t.Duration = uint64(decodeTime)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package mov
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	prores "github.com/theaaf/prores-go"
+)
+
+func testAtom(atomType string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	ret := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(ret, uint32(8+len(data)))
+	copy(ret[4:], atomType)
+	return append(ret, data...)
+}
+
+func testUint32s(values ...uint32) []byte {
+	ret := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(ret[i*4:], v)
+	}
+	return ret
+}
+
+func testUint64s(values ...uint64) []byte {
+	ret := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(ret[i*8:], v)
+	}
+	return ret
+}
+
+// Builds a movie with a single video track. The first two samples are in the first chunk and the
+// rest are in a second chunk.
+func testMovie(fourCC string, width, height int, samples [][]byte, use64BitOffsets bool) []byte {
+	ftyp := testAtom("ftyp", []byte("qt  "), testUint32s(0x200), []byte("qt  "))
+
+	mdatPayloadOffset := uint64(len(ftyp) + 8)
+	secondChunkOffset := mdatPayloadOffset
+	for _, s := range samples[:2] {
+		secondChunkOffset += uint64(len(s))
+	}
+	mdat := testAtom("mdat", samples...)
+
+	var sizes []uint32
+	for _, s := range samples {
+		sizes = append(sizes, uint32(len(s)))
+	}
+
+	var chunkOffsets []byte
+	if use64BitOffsets {
+		chunkOffsets = testAtom("co64", testUint32s(0, 2), testUint64s(mdatPayloadOffset, secondChunkOffset))
+	} else {
+		chunkOffsets = testAtom("stco", testUint32s(0, 2, uint32(mdatPayloadOffset), uint32(secondChunkOffset)))
+	}
+
+	sampleEntry := make([]byte, 70)
+	binary.BigEndian.PutUint16(sampleEntry[6:], 1)
+	binary.BigEndian.PutUint16(sampleEntry[24:], uint16(width))
+	binary.BigEndian.PutUint16(sampleEntry[26:], uint16(height))
+
+	const timescale = 30000
+	duration := uint32(len(samples) * 1001)
+	moov := testAtom("moov",
+		testAtom("mvhd", testUint32s(0, 0, 0, 600, uint32(len(samples)*20)), make([]byte, 80)),
+		testAtom("trak",
+			testAtom("tkhd", testUint32s(0, 0, 0, 1, 0, uint32(len(samples)*20)), make([]byte, 60)),
+			testAtom("mdia",
+				testAtom("mdhd", testUint32s(0, 0, 0, timescale, duration), make([]byte, 4)),
+				testAtom("hdlr", testUint32s(0), []byte("mhlrvide"), make([]byte, 13)),
+				testAtom("minf",
+					testAtom("stbl",
+						testAtom("stsd", testUint32s(0, 1), testAtom(fourCC, sampleEntry)),
+						testAtom("stts", testUint32s(0, 1, uint32(len(samples)), 1001)),
+						testAtom("stsc", testUint32s(0, 2, 1, 2, 1, 2, uint32(len(samples)-2), 1)),
+						testAtom("stsz", testUint32s(0, 0, uint32(len(samples))), testUint32s(sizes...)),
+						chunkOffsets,
+					),
+				),
+			),
+		),
+	)
+
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func TestReader(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	samples := [][]byte{[]byte("foo"), testAtom("icpf", frame), []byte("barbaz"), []byte("qux")}
+	expectedSamples := [][]byte{[]byte("foo"), frame, []byte("barbaz"), []byte("qux")}
+
+	for _, use64BitOffsets := range []bool{false, true} {
+		movie := testMovie("apch", 1920, 1080, samples, use64BitOffsets)
+		r, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+		require.NoError(t, err)
+
+		assert.EqualValues(t, 600, r.Timescale)
+		assert.EqualValues(t, 80, r.Duration)
+		require.Len(t, r.Tracks, 1)
+		require.Len(t, r.ProResTracks(), 1)
+
+		track := r.Tracks[0]
+		assert.EqualValues(t, 1, track.ID)
+		assert.Equal(t, "vide", track.HandlerType)
+		assert.Equal(t, "apch", track.FourCC)
+		assert.Equal(t, 1920, track.Width)
+		assert.Equal(t, 1080, track.Height)
+		assert.EqualValues(t, 30000, track.Timescale)
+		require.Equal(t, len(samples), track.NumSamples())
+
+		// The frame's icpf container should be excluded.
+		for i, expected := range expectedSamples {
+			sr, err := track.Sample(i)
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(sr)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		}
+		_, err = track.Sample(len(samples))
+		assert.Error(t, err)
+
+		sr, err := track.Sample(1)
+		require.NoError(t, err)
+		img, err := prores.DecodeFrame(sr, sr.Size())
+		require.NoError(t, err)
+		assert.Equal(t, 1920, img.Bounds().Dx())
+	}
+}
+
+func TestTrack_Sample_InvalidContainer(t *testing.T) {
+	container := testAtom("icpf", []byte("abc"))
+	binary.BigEndian.PutUint32(container, 100)
+	movie := testMovie("apcn", 16, 16, [][]byte{[]byte("a"), container, []byte("c")}, false)
+	r, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+	require.NoError(t, err)
+	_, err = r.Tracks[0].Sample(1)
+	assert.Error(t, err)
+}
+
+func TestTrack_SampleAtTime(t *testing.T) {
+	samples := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	movie := testMovie("apcn", 16, 16, samples, false)
+	r, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+	require.NoError(t, err)
+	track := r.Tracks[0]
+
+	d, err := track.SampleTime(1)
+	require.NoError(t, err)
+	assert.Equal(t, 33366667*time.Nanosecond, d)
+
+	for _, tc := range []struct {
+		Time   time.Duration
+		Sample int
+	}{
+		{0, 0},
+		{33 * time.Millisecond, 0},
+		{34 * time.Millisecond, 1},
+		{d, 1},
+		{99 * time.Millisecond, 2},
+	} {
+		n, err := track.SampleAtTime(tc.Time)
+		require.NoError(t, err)
+		assert.Equal(t, tc.Sample, n, "time: %v", tc.Time)
+	}
+
+	_, err = track.SampleAtTime(101 * time.Millisecond)
+	assert.Error(t, err)
+	_, err = track.SampleAtTime(-time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestNewReader_Malformed(t *testing.T) {
+	movie := testMovie("apcn", 16, 16, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, false)
+
+	// Every truncation should produce an error rather than a panic.
+	for i := 0; i < len(movie); i++ {
+		_, err := NewReader(bytes.NewReader(movie[:i]), int64(i))
+		assert.Error(t, err, "length: %v", i)
+	}
+
+	// A uniform sample size mustn't let the sample count exceed what the file can hold.
+	stsz := bytes.Index(movie, []byte("stsz")) + 8
+	oversized := append([]byte(nil), movie...)
+	binary.BigEndian.PutUint32(oversized[stsz:], 0x10000)
+	binary.BigEndian.PutUint32(oversized[stsz+4:], uint32(len(movie)))
+	_, err := NewReader(bytes.NewReader(oversized), int64(len(oversized)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than the file")
+
+	// Corrupt fields must not cause panics either.
+	for i := 0; i+4 <= len(movie); i++ {
+		corrupted := append([]byte(nil), movie...)
+		binary.BigEndian.PutUint32(corrupted[i:], 0xffffffff)
+		NewReader(bytes.NewReader(corrupted), int64(len(corrupted)))
+	}
+}
@@ -0,0 +1,469 @@
+package mov
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	prores "github.com/theaaf/prores-go"
+)
+
+var compressorNames = map[string]string{
+	"apco": "Apple ProRes 422 Proxy",
+	"apcs": "Apple ProRes 422 LT",
+	"apcn": "Apple ProRes 422",
+	"apch": "Apple ProRes 422 HQ",
+	"ap4h": "Apple ProRes 4444",
+	"ap4x": "Apple ProRes 4444 XQ",
+}
+
+// WriterConfig describes the video track written by a Writer.
+type WriterConfig struct {
+	// The ProRes fourcc of the frames, such as "apch". If the frames are produced by a
+	// prores.Encoder, this is its profile's FourCC.
+	FourCC string
+
+	// The frame rate as a fraction, such as 30000/1001.
+	FrameRateNumerator   int
+	FrameRateDenominator int
+
+	// The dimensions of the frames. If zero, the dimensions are taken from the first frame.
+	Width  int
+	Height int
+}
+
+// Writer writes a QuickTime movie with a single ProRes video track. The frames are written as
+// they're received, and the moov atom is written at the end by Close. Use Faststart to move the
+// moov atom to the beginning of the file afterwards.
+type Writer struct {
+	w      io.WriteSeeker
+	config WriterConfig
+
+	// The offset of the "wide" atom that precedes the mdat atom. If the mdat atom exceeds 4 GiB,
+	// the two are combined into a single 64-bit mdat header.
+	wideOffset int64
+	offset     int64
+
+	// The header of the first frame, from which the sample description is derived.
+	header *prores.FrameHeader
+
+	sampleSizes  []uint32
+	chunkOffsets []uint64
+}
+
+// Creates a new Writer and writes the ftyp atom and mdat header to w, starting at its current
+// position.
+func NewWriter(w io.WriteSeeker, config WriterConfig) (*Writer, error) {
+	if _, ok := compressorNames[config.FourCC]; !ok {
+		return nil, fmt.Errorf("unsupported fourcc %q", config.FourCC)
+	} else if config.FrameRateNumerator <= 0 || config.FrameRateDenominator <= 0 ||
+		uint64(config.FrameRateNumerator) > math.MaxUint32 || uint64(config.FrameRateDenominator) > math.MaxUint32 {
+		return nil, fmt.Errorf("invalid frame rate")
+	} else if config.Width < 0 || config.Height < 0 || config.Width > math.MaxUint16 || config.Height > math.MaxUint16 {
+		return nil, fmt.Errorf("invalid dimensions")
+	}
+
+	offset, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Writer{
+		w:      w,
+		config: config,
+		offset: offset,
+	}
+
+	ftyp := newAtomBuilder("ftyp")
+	ftyp.str("qt  ")
+	ftyp.u32(0x200)
+	ftyp.str("qt  ")
+	if err := ret.write(ftyp.bytes()); err != nil {
+		return nil, err
+	}
+
+	ret.wideOffset = ret.offset
+	mdatHeader := newAtomBuilder("wide").bytes()
+	mdatHeader = append(mdatHeader, newAtomBuilder("mdat").bytes()...)
+	if err := ret.write(mdatHeader); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.offset += int64(n)
+	return err
+}
+
+// Appends a frame to the movie. Each frame is stored in its own chunk. Frames that aren't already
+// wrapped in an icpf container, such as those produced by prores.Encoder, are wrapped in one.
+func (w *Writer) WriteFrame(frame []byte) error {
+	if uint64(len(frame)) > math.MaxUint32-8 {
+		return fmt.Errorf("frame is too large")
+	}
+	fr, err := prores.NewFrameReader(bytes.NewReader(frame), int64(len(frame)))
+	if err != nil {
+		return err
+	}
+	var header prores.FrameHeader
+	if err := header.Decode(fr); err != nil {
+		return fmt.Errorf("unable to decode frame header: %w", err)
+	}
+
+	if w.header == nil {
+		w.header = &header
+		if w.config.Width == 0 {
+			w.config.Width = header.Width
+		}
+		if w.config.Height == 0 {
+			w.config.Height = header.Height
+		}
+	}
+
+	w.chunkOffsets = append(w.chunkOffsets, uint64(w.offset))
+	size := len(frame)
+	if !fr.HasContainer {
+		size += 8
+		container := make([]byte, 8)
+		binary.BigEndian.PutUint32(container, uint32(size))
+		copy(container[4:], "icpf")
+		if err := w.write(container); err != nil {
+			return err
+		}
+	}
+	w.sampleSizes = append(w.sampleSizes, uint32(size))
+	return w.write(frame)
+}
+
+// Writes the moov atom and finalizes the mdat header. The underlying writer isn't closed.
+func (w *Writer) Close() error {
+	if w.header == nil {
+		return fmt.Errorf("no frames were written")
+	}
+
+	mdatEnd := w.offset
+	if err := w.write(w.moov()); err != nil {
+		return err
+	}
+	end := w.offset
+
+	mdatSize := uint64(mdatEnd - w.wideOffset - 8)
+	var header []byte
+	if mdatSize <= math.MaxUint32 {
+		// Keep the wide atom and fill in the 32-bit size.
+		header = make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(mdatSize))
+		if _, err := w.w.Seek(w.wideOffset+8, io.SeekStart); err != nil {
+			return err
+		}
+	} else {
+		// Replace the wide atom with a 64-bit size.
+		header = make([]byte, 16)
+		binary.BigEndian.PutUint32(header, 1)
+		copy(header[4:], "mdat")
+		binary.BigEndian.PutUint64(header[8:], mdatSize+8)
+		if _, err := w.w.Seek(w.wideOffset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(end, io.SeekStart)
+	return err
+}
+
+func (w *Writer) moov() []byte {
+	timescale := uint32(w.config.FrameRateNumerator)
+	frameDuration := uint32(w.config.FrameRateDenominator)
+	duration := uint64(len(w.sampleSizes)) * uint64(frameDuration)
+	pixelAspectH, pixelAspectV := pixelAspectRatio(w.header.AspectRatio, w.config.Width, w.config.Height)
+
+	moov := newAtomBuilder("moov")
+
+	mvhd := moov.child("mvhd")
+	writeTimescaleAndDuration(mvhd, timescale, duration)
+	mvhd.u32(0x00010000) // preferred rate
+	mvhd.u16(0x0100)     // preferred volume
+	mvhd.zeros(10)
+	writeIdentityMatrix(mvhd)
+	mvhd.zeros(24)
+	mvhd.u32(2) // next track id
+
+	trak := moov.child("trak")
+
+	tkhd := trak.child("tkhd")
+	if duration > math.MaxUint32 {
+		tkhd.u32(0x01000003) // version 1, enabled, in movie
+		tkhd.zeros(16)
+		tkhd.u32(1) // track id
+		tkhd.zeros(4)
+		tkhd.u64(duration)
+	} else {
+		tkhd.u32(0x00000003) // enabled, in movie
+		tkhd.zeros(8)
+		tkhd.u32(1) // track id
+		tkhd.zeros(4)
+		tkhd.u32(uint32(duration))
+	}
+	tkhd.zeros(16) // reserved, layer, alternate group, volume, reserved
+	writeIdentityMatrix(tkhd)
+	tkhd.u32(uint32(uint64(w.config.Width) * uint64(pixelAspectH) << 16 / uint64(pixelAspectV)))
+	tkhd.u32(uint32(w.config.Height) << 16)
+
+	mdia := trak.child("mdia")
+
+	mdhd := mdia.child("mdhd")
+	writeTimescaleAndDuration(mdhd, timescale, duration)
+	mdhd.u16(0x7fff) // unspecified language
+	mdhd.u16(0)      // quality
+
+	writeHandler(mdia.child("hdlr"), "mhlr", "vide", "VideoHandler")
+
+	minf := mdia.child("minf")
+
+	vmhd := minf.child("vmhd")
+	vmhd.u32(1) // no lean ahead
+	vmhd.u16(0x40)
+	vmhd.zeros(6)
+
+	writeHandler(minf.child("hdlr"), "dhlr", "alis", "DataHandler")
+
+	dref := minf.child("dinf").child("dref")
+	dref.u32(0)
+	dref.u32(1)
+	dref.child("alis").u32(1) // self-reference
+
+	stbl := minf.child("stbl")
+	w.writeSampleDescription(stbl.child("stsd"), pixelAspectH, pixelAspectV)
+
+	stts := stbl.child("stts")
+	stts.u32(0)
+	stts.u32(1)
+	stts.u32(uint32(len(w.sampleSizes)))
+	stts.u32(frameDuration)
+
+	stsc := stbl.child("stsc")
+	stsc.u32(0)
+	stsc.u32(1)
+	stsc.u32(1) // first chunk
+	stsc.u32(1) // samples per chunk
+	stsc.u32(1) // sample description id
+
+	stsz := stbl.child("stsz")
+	stsz.u32(0)
+	stsz.u32(0)
+	stsz.u32(uint32(len(w.sampleSizes)))
+	for _, size := range w.sampleSizes {
+		stsz.u32(size)
+	}
+
+	if last := w.chunkOffsets[len(w.chunkOffsets)-1]; last > math.MaxUint32 {
+		co64 := stbl.child("co64")
+		co64.u32(0)
+		co64.u32(uint32(len(w.chunkOffsets)))
+		for _, offset := range w.chunkOffsets {
+			co64.u64(offset)
+		}
+	} else {
+		stco := stbl.child("stco")
+		stco.u32(0)
+		stco.u32(uint32(len(w.chunkOffsets)))
+		for _, offset := range w.chunkOffsets {
+			stco.u32(uint32(offset))
+		}
+	}
+
+	return moov.bytes()
+}
+
+func (w *Writer) writeSampleDescription(stsd *atomBuilder, pixelAspectH, pixelAspectV uint32) {
+	stsd.u32(0)
+	stsd.u32(1)
+
+	entry := stsd.child(w.config.FourCC)
+	entry.zeros(6)
+	entry.u16(1) // data reference index
+	entry.u16(0) // version
+	entry.u16(0) // revision level
+	entry.str("appl")
+	entry.u32(0)     // temporal quality
+	entry.u32(0x200) // spatial quality
+	entry.u16(uint16(w.config.Width))
+	entry.u16(uint16(w.config.Height))
+	entry.u32(72 << 16) // horizontal resolution
+	entry.u32(72 << 16) // vertical resolution
+	entry.u32(0)        // data size
+	entry.u16(1)        // frame count
+
+	name := compressorNames[w.config.FourCC]
+	entry.u8(uint8(len(name)))
+	entry.str(name)
+	entry.zeros(31 - len(name))
+
+	if w.header.AlphaInfo.HasAlpha() {
+		entry.u16(32)
+	} else {
+		entry.u16(24)
+	}
+	entry.u16(0xffff) // no color table
+
+	colr := entry.child("colr")
+	colr.str("nclc")
+	colr.u16(uint16(nclcValue(byte(w.header.ColorPrimaries))))
+	colr.u16(uint16(nclcValue(byte(w.header.TransferCharacteristic))))
+	colr.u16(uint16(nclcValue(byte(w.header.MatrixCoefficients))))
+
+	fiel := entry.child("fiel")
+	switch w.header.Flags.InterlaceMode() {
+	case prores.InterlaceModeTopFirst:
+		fiel.u8(2)
+		fiel.u8(9)
+	case prores.InterlaceModeTopSecond:
+		fiel.u8(2)
+		fiel.u8(14)
+	default:
+		fiel.u8(1)
+		fiel.u8(0)
+	}
+
+	pasp := entry.child("pasp")
+	pasp.u32(pixelAspectH)
+	pasp.u32(pixelAspectV)
+}
+
+// ProRes frame headers use the ISO/IEC 23001-8 code points just like nclc color atoms, but 0 is
+// used for unknown values instead of 2.
+func nclcValue(v byte) byte {
+	if v == 0 {
+		return 2
+	}
+	return v
+}
+
+// Returns the pixel aspect ratio that results in the frame's display aspect ratio.
+func pixelAspectRatio(aspectRatio prores.AspectRatio, width, height int) (h, v uint32) {
+	var displayH, displayV uint64
+	switch aspectRatio {
+	case prores.AspectRatio4x3:
+		displayH, displayV = 4, 3
+	case prores.AspectRatio16x9:
+		displayH, displayV = 16, 9
+	default:
+		return 1, 1
+	}
+	if width == 0 || height == 0 {
+		return 1, 1
+	}
+	h64, v64 := displayH*uint64(height), displayV*uint64(width)
+	d := gcd(h64, v64)
+	return uint32(h64 / d), uint32(v64 / d)
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func writeTimescaleAndDuration(b *atomBuilder, timescale uint32, duration uint64) {
+	if duration > math.MaxUint32 {
+		b.u32(1 << 24) // version 1
+		b.zeros(16)
+		b.u32(timescale)
+		b.u64(duration)
+	} else {
+		b.u32(0)
+		b.zeros(8)
+		b.u32(timescale)
+		b.u32(uint32(duration))
+	}
+}
+
+func writeIdentityMatrix(b *atomBuilder) {
+	b.u32(0x00010000)
+	b.zeros(12)
+	b.u32(0x00010000)
+	b.zeros(12)
+	b.u32(0x40000000)
+}
+
+func writeHandler(b *atomBuilder, componentType, componentSubtype, name string) {
+	b.u32(0)
+	b.str(componentType)
+	b.str(componentSubtype)
+	b.zeros(12) // manufacturer, flags, flags mask
+	b.u8(uint8(len(name)))
+	b.str(name)
+}
+
+// atomBuilder accumulates the payload of an atom and its children.
+type atomBuilder struct {
+	atomType string
+	buf      []byte
+	children []*atomBuilder
+
+	// For each child, the length of buf at the time it was added.
+	childOffsets []int
+}
+
+func newAtomBuilder(atomType string) *atomBuilder {
+	return &atomBuilder{
+		atomType: atomType,
+	}
+}
+
+// Adds a child atom. Fields written to the parent afterwards follow the child.
+func (b *atomBuilder) child(atomType string) *atomBuilder {
+	ret := newAtomBuilder(atomType)
+	b.children = append(b.children, ret)
+	b.childOffsets = append(b.childOffsets, len(b.buf))
+	return ret
+}
+
+func (b *atomBuilder) u8(v uint8) {
+	b.buf = append(b.buf, v)
+}
+
+func (b *atomBuilder) u16(v uint16) {
+	b.buf = append(b.buf, byte(v>>8), byte(v))
+}
+
+func (b *atomBuilder) u32(v uint32) {
+	b.buf = append(b.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *atomBuilder) u64(v uint64) {
+	b.u32(uint32(v >> 32))
+	b.u32(uint32(v))
+}
+
+func (b *atomBuilder) str(s string) {
+	b.buf = append(b.buf, s...)
+}
+
+func (b *atomBuilder) zeros(n int) {
+	for i := 0; i < n; i++ {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// Serializes the atom, including its header.
+func (b *atomBuilder) bytes() []byte {
+	ret := make([]byte, 8, 8+len(b.buf))
+	copy(ret[4:], b.atomType)
+	prev := 0
+	for i, child := range b.children {
+		ret = append(ret, b.buf[prev:b.childOffsets[i]]...)
+		ret = append(ret, child.bytes()...)
+		prev = b.childOffsets[i]
+	}
+	ret = append(ret, b.buf[prev:]...)
+	binary.BigEndian.PutUint32(ret, uint32(len(ret)))
+	return ret
+}
@@ -0,0 +1,345 @@
+package mov
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	prores "github.com/theaaf/prores-go"
+)
+
+// Writes the frames to a movie and returns its contents.
+func writeTestMovie(t *testing.T, config WriterConfig, frames ...[]byte) []byte {
+	f, err := ioutil.TempFile("", "prores-mov-test")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := NewWriter(f, config)
+	require.NoError(t, err)
+	for _, frame := range frames {
+		require.NoError(t, w.WriteFrame(frame))
+	}
+	require.NoError(t, w.Close())
+
+	buf, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	return buf
+}
+
+// Returns the payload of the first sample description's extension atom of the given type.
+func sampleDescriptionExtension(t *testing.T, movie []byte, atomType string) []byte {
+	r := bytes.NewReader(movie)
+	atoms, err := readAtoms(r, 0, int64(len(movie)))
+	require.NoError(t, err)
+	moov := findAtom(atoms, "moov")
+	require.NotNil(t, moov)
+	moovChildren, err := moov.children(r)
+	require.NoError(t, err)
+	trak := findAtom(moovChildren, "trak")
+	require.NotNil(t, trak)
+	stbl, err := findChildren(r, trak, "mdia", "minf", "stbl")
+	require.NoError(t, err)
+	stsd, err := readLeaf(r, stbl, "stsd")
+	require.NoError(t, err)
+
+	entry := stsd[8:]
+	entrySize := binary.BigEndian.Uint32(entry)
+	extensions, err := readAtoms(bytes.NewReader(entry), 86, int64(entrySize)-86)
+	require.NoError(t, err)
+	extension := findAtom(extensions, atomType)
+	require.NotNil(t, extension, atomType)
+	return entry[extension.Offset:extension.end()]
+}
+
+func TestWriter(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	var header prores.FrameHeader
+	require.NoError(t, header.Decode(bytes.NewReader(frame)))
+
+	movie := writeTestMovie(t, WriterConfig{
+		FourCC:               "apch",
+		FrameRateNumerator:   30000,
+		FrameRateDenominator: 1001,
+	}, frame, frame, frame)
+
+	r, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+	require.NoError(t, err)
+	require.Len(t, r.ProResTracks(), 1)
+	track := r.ProResTracks()[0]
+	assert.Equal(t, "apch", track.FourCC)
+	assert.Equal(t, header.Width, track.Width)
+	assert.Equal(t, header.Height, track.Height)
+	assert.EqualValues(t, 30000, track.Timescale)
+	assert.EqualValues(t, 3003, track.Duration)
+	require.Equal(t, 3, track.NumSamples())
+
+	// The frames should have been wrapped in icpf containers, which Sample excludes.
+	for i := 0; i < 3; i++ {
+		s := track.samples[i]
+		require.EqualValues(t, len(frame)+8, s.Size)
+		assert.EqualValues(t, len(frame)+8, binary.BigEndian.Uint32(movie[s.Offset:]))
+		assert.Equal(t, "icpf", string(movie[s.Offset+4:][:4]))
+
+		sr, err := track.Sample(i)
+		require.NoError(t, err)
+		actual, err := ioutil.ReadAll(sr)
+		require.NoError(t, err)
+		assert.Equal(t, frame, actual)
+	}
+
+	sr, err := track.Sample(0)
+	require.NoError(t, err)
+	_, err = prores.DecodeFrame(sr, sr.Size())
+	require.NoError(t, err)
+
+	n, err := track.SampleAtTime(70 * time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	colr := sampleDescriptionExtension(t, movie, "colr")
+	assert.Equal(t, "nclc", string(colr[:4]))
+	assert.EqualValues(t, nclcValue(byte(header.ColorPrimaries)), binary.BigEndian.Uint16(colr[4:]))
+	assert.EqualValues(t, nclcValue(byte(header.TransferCharacteristic)), binary.BigEndian.Uint16(colr[6:]))
+	assert.EqualValues(t, nclcValue(byte(header.MatrixCoefficients)), binary.BigEndian.Uint16(colr[8:]))
+	assert.Equal(t, []byte{1, 0}, sampleDescriptionExtension(t, movie, "fiel"))
+	assert.Len(t, sampleDescriptionExtension(t, movie, "pasp"), 8)
+}
+
+func TestWriter_Interlaced(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/bir-atl-interlaced-frame.icpf")
+	require.NoError(t, err)
+
+	// This frame is already wrapped in a container, so it should be written as-is.
+	wrapped := make([]byte, 8, 8+len(frame))
+	binary.BigEndian.PutUint32(wrapped, uint32(8+len(frame)))
+	copy(wrapped[4:], "icpf")
+	wrapped = append(wrapped, frame...)
+
+	movie := writeTestMovie(t, WriterConfig{
+		FourCC:               "apcn",
+		FrameRateNumerator:   30000,
+		FrameRateDenominator: 1001,
+	}, wrapped)
+	assert.Equal(t, []byte{2, 9}, sampleDescriptionExtension(t, movie, "fiel"))
+
+	r, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+	require.NoError(t, err)
+	track := r.Tracks[0]
+	assert.EqualValues(t, len(wrapped), track.samples[0].Size)
+	sr, err := track.Sample(0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(frame)), sr.Size())
+}
+
+func TestWriter_LargeOffsets(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	var header prores.FrameHeader
+	require.NoError(t, header.Decode(bytes.NewReader(frame)))
+
+	// Rather than writing more than 4 GiB, build the moov atom for a hypothetical large file.
+	w := &Writer{
+		config: WriterConfig{
+			FourCC:               "apch",
+			FrameRateNumerator:   25,
+			FrameRateDenominator: 1,
+		},
+		header:       &header,
+		sampleSizes:  []uint32{uint32(len(frame)), uint32(len(frame))},
+		chunkOffsets: []uint64{48, 1 << 33},
+	}
+	moov := w.moov()
+
+	r := bytes.NewReader(moov)
+	atoms, err := readAtoms(r, 0, int64(len(moov)))
+	require.NoError(t, err)
+	moovChildren, err := atoms[0].children(r)
+	require.NoError(t, err)
+	stbl, err := findChildren(r, findAtom(moovChildren, "trak"), "mdia", "minf", "stbl")
+	require.NoError(t, err)
+	assert.Nil(t, findAtom(stbl, "stco"))
+	entries, count, err := readTable(r, stbl, "co64", 8)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	assert.EqualValues(t, 48, binary.BigEndian.Uint64(entries))
+	assert.EqualValues(t, uint64(1)<<33, binary.BigEndian.Uint64(entries[8:]))
+}
+
+func TestPixelAspectRatio(t *testing.T) {
+	h, v := pixelAspectRatio(prores.AspectRatio16x9, 1440, 1080)
+	assert.Equal(t, []uint32{4, 3}, []uint32{h, v})
+
+	h, v = pixelAspectRatio(prores.AspectRatio4x3, 720, 486)
+	assert.Equal(t, []uint32{9, 10}, []uint32{h, v})
+
+	h, v = pixelAspectRatio(prores.AspectRatioSquare, 1920, 1080)
+	assert.Equal(t, []uint32{1, 1}, []uint32{h, v})
+}
+
+func TestFaststart(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+
+	movie := writeTestMovie(t, WriterConfig{
+		FourCC:               "apch",
+		FrameRateNumerator:   24,
+		FrameRateDenominator: 1,
+	}, frame, frame[:len(frame)/2], frame)
+
+	var buf bytes.Buffer
+	require.NoError(t, Faststart(&buf, bytes.NewReader(movie), int64(len(movie))))
+	faststart := buf.Bytes()
+	require.Len(t, faststart, len(movie))
+
+	atoms, err := readAtoms(bytes.NewReader(faststart), 0, int64(len(faststart)))
+	require.NoError(t, err)
+	var types []string
+	for _, a := range atoms {
+		types = append(types, a.Type)
+	}
+	assert.Equal(t, []string{"ftyp", "wide", "moov", "mdat"}, types)
+
+	original, err := NewReader(bytes.NewReader(movie), int64(len(movie)))
+	require.NoError(t, err)
+	rewritten, err := NewReader(bytes.NewReader(faststart), int64(len(faststart)))
+	require.NoError(t, err)
+	require.Equal(t, 3, rewritten.Tracks[0].NumSamples())
+	for i := 0; i < 3; i++ {
+		sr, err := original.Tracks[0].Sample(i)
+		require.NoError(t, err)
+		expected, err := ioutil.ReadAll(sr)
+		require.NoError(t, err)
+
+		sr, err = rewritten.Tracks[0].Sample(i)
+		require.NoError(t, err)
+		actual, err := ioutil.ReadAll(sr)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+
+	// Rewriting it again should be a no-op.
+	var again bytes.Buffer
+	require.NoError(t, Faststart(&again, bytes.NewReader(faststart), int64(len(faststart))))
+	assert.Equal(t, faststart, again.Bytes())
+}
+
+// A movie whose media data is all zeros, so that large movies can be tested without storing them.
+type sparseMovie struct {
+	head, tail []byte
+	size       int64
+}
+
+func (m *sparseMovie) ReadAt(p []byte, off int64) (int, error) {
+	if off >= m.size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > m.size-off {
+		p = p[:m.size-off]
+		err = io.EOF
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	if off < int64(len(m.head)) {
+		copy(p, m.head[off:])
+	}
+	if tailStart := m.size - int64(len(m.tail)); off < tailStart {
+		if end := off + int64(len(p)); end > tailStart {
+			copy(p[tailStart-off:], m.tail)
+		}
+	} else {
+		copy(p, m.tail[off-tailStart:])
+	}
+	return len(p), err
+}
+
+// Keeps the first bytes written to it and counts the rest.
+type headWriter struct {
+	head []byte
+	n    int64
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if room := 1<<16 - len(w.head); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		w.head = append(w.head, p[:room]...)
+	}
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func TestFaststart_LargeOffsets(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	var header prores.FrameHeader
+	require.NoError(t, header.Decode(bytes.NewReader(frame)))
+
+	// The last chunk ends just short of 4 GiB, so its offset only overflows once the moov atom moves
+	// in front of it.
+	ftyp := newAtomBuilder("ftyp")
+	ftyp.str("qt  ")
+	ftyp.u32(0x200)
+	ftyp.str("qt  ")
+	head := ftyp.bytes()
+	mdatEnd := int64(math.MaxUint32 - 16)
+	mdatHeader := make([]byte, 8)
+	binary.BigEndian.PutUint32(mdatHeader, uint32(mdatEnd-int64(len(head))))
+	copy(mdatHeader[4:], "mdat")
+	head = append(head, mdatHeader...)
+
+	chunkOffsets := []uint64{uint64(len(head)), uint64(mdatEnd) - 16}
+	w := &Writer{
+		config: WriterConfig{
+			FourCC:               "apch",
+			FrameRateNumerator:   25,
+			FrameRateDenominator: 1,
+		},
+		header:       &header,
+		sampleSizes:  []uint32{uint32(len(frame)), 16},
+		chunkOffsets: chunkOffsets,
+	}
+	moov := w.moov()
+	movie := &sparseMovie{
+		head: head,
+		tail: moov,
+		size: mdatEnd + int64(len(moov)),
+	}
+
+	var dst headWriter
+	require.NoError(t, Faststart(&dst, movie, movie.size))
+
+	// The moov atom grows by 4 bytes for each chunk offset.
+	moovSize := int64(binary.BigEndian.Uint32(dst.head[len(ftyp.bytes()):]))
+	require.Equal(t, int64(len(moov))+4*int64(len(chunkOffsets)), moovSize)
+	assert.Equal(t, movie.size+moovSize-int64(len(moov)), dst.n)
+
+	r := bytes.NewReader(dst.head)
+	atoms, err := readAtoms(r, int64(len(ftyp.bytes())), moovSize)
+	require.NoError(t, err)
+	require.Equal(t, "moov", atoms[0].Type)
+	moovChildren, err := atoms[0].children(r)
+	require.NoError(t, err)
+	stbl, err := findChildren(r, findAtom(moovChildren, "trak"), "mdia", "minf", "stbl")
+	require.NoError(t, err)
+	assert.Nil(t, findAtom(stbl, "stco"))
+	entries, count, err := readTable(r, stbl, "co64", 8)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	for i, offset := range chunkOffsets {
+		assert.Equal(t, offset+uint64(moovSize), binary.BigEndian.Uint64(entries[i*8:]))
+	}
+	assert.True(t, binary.BigEndian.Uint64(entries[8:]) > math.MaxUint32)
+}
@@ -0,0 +1,109 @@
+package mxf
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// UL is a SMPTE universal label, which MXF uses as the key of each KLV triplet.
+type UL [16]byte
+
+func (ul UL) String() string {
+	return hex.EncodeToString(ul[:])
+}
+
+// Returns true if the labels are equal, ignoring the version byte.
+func (ul UL) Equivalent(other UL) bool {
+	for i := range ul {
+		if i != 7 && ul[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the first n bytes of the label match prefix, ignoring the version byte.
+func (ul UL) hasPrefix(prefix UL, n int) bool {
+	for i := 0; i < n; i++ {
+		if i != 7 && ul[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// A klv is a key-length-value triplet whose key is at Start and whose value is at
+// [Offset, Offset+Length) of the underlying reader.
+type klv struct {
+	Key    UL
+	Start  int64
+	Offset int64
+	Length int64
+}
+
+// Returns the offset immediately following the triplet.
+func (k *klv) end() int64 {
+	return k.Offset + k.Length
+}
+
+// Reads the key and length of the KLV triplet at the given offset. end is the offset that the
+// triplet must not extend past.
+func readKLV(r io.ReaderAt, offset, end int64) (*klv, error) {
+	var buf [25]byte
+	n := int64(len(buf))
+	if end-offset < n {
+		n = end - offset
+	}
+	if n < 17 {
+		return nil, fmt.Errorf("truncated klv at offset %v", offset)
+	}
+	if read, err := r.ReadAt(buf[:n], offset); int64(read) < n {
+		return nil, err
+	}
+
+	ret := &klv{
+		Start: offset,
+	}
+	copy(ret.Key[:], buf[:16])
+
+	// The length is BER encoded.
+	lengthSize := int64(1)
+	if first := buf[16]; first < 0x80 {
+		ret.Length = int64(first)
+	} else {
+		lengthSize += int64(first & 0x7f)
+		if lengthSize == 1 || lengthSize > 9 {
+			return nil, fmt.Errorf("unsupported length encoding at offset %v", offset)
+		} else if 16+lengthSize > n {
+			return nil, fmt.Errorf("truncated klv at offset %v", offset)
+		}
+		var length uint64
+		for _, b := range buf[17 : 16+lengthSize] {
+			length = length<<8 | uint64(b)
+		}
+		if length > uint64(end-offset) {
+			return nil, fmt.Errorf("klv at offset %v exceeds the file", offset)
+		}
+		ret.Length = int64(length)
+	}
+
+	ret.Offset = offset + 16 + lengthSize
+	if ret.Length > end-ret.Offset {
+		return nil, fmt.Errorf("klv at offset %v exceeds the file", offset)
+	}
+	return ret, nil
+}
+
+// Reads the value of a KLV triplet. Values longer than maxLength are rejected so that corrupt
+// lengths can't cause huge allocations.
+func (k *klv) read(r io.ReaderAt, maxLength int64) ([]byte, error) {
+	if k.Length > maxLength {
+		return nil, fmt.Errorf("klv value too long")
+	}
+	buf := make([]byte, k.Length)
+	if n, err := r.ReadAt(buf, k.Offset); n < len(buf) {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,286 @@
+package mxf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	// Partition packs share the first 13 bytes. Byte 13 is the partition kind and byte 14 is its
+	// status.
+	partitionPackKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x00, 0x00, 0x00}
+
+	primerPackKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x05, 0x01, 0x00}
+
+	randomIndexPackKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x11, 0x01, 0x00}
+
+	indexTableSegmentKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x10, 0x01, 0x00}
+
+	// Header metadata sets share the first 13 bytes. Bytes 13 and 14 identify the set.
+	metadataSetKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x01, 0x01, 0x01, 0x00, 0x00, 0x00}
+
+	// Generic container picture items share the first 13 bytes.
+	pictureItemKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x02, 0x01, 0x01, 0x0d, 0x01, 0x03, 0x01, 0x15, 0x00, 0x00, 0x00}
+
+	// Operational patterns share the first 12 bytes. Bytes 12 and 13 are the item and package
+	// complexity.
+	operationalPatternKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00}
+
+	// ProRes picture essence coding labels share the first 14 bytes. Byte 14 is the profile.
+	proResPictureEssenceCodingKey = UL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x0d, 0x04, 0x01, 0x02, 0x02, 0x03, 0x06, 0x00, 0x00}
+)
+
+const (
+	cdciDescriptorSetID = 0x0128
+	rgbaDescriptorSetID = 0x0129
+)
+
+// The ProRes fourccs indexed by the profile byte of their picture essence coding labels.
+var proResFourCCs = [...]string{1: "apco", 2: "apcs", 3: "apcn", 4: "apch", 5: "ap4h", 6: "ap4x"}
+
+type PartitionKind byte
+
+const (
+	PartitionKindHeader PartitionKind = 2
+	PartitionKindBody   PartitionKind = 3
+	PartitionKindFooter PartitionKind = 4
+)
+
+// Partition is a parsed partition pack.
+type Partition struct {
+	Kind PartitionKind
+
+	// The file offset of the partition pack.
+	Offset int64
+
+	// The offset of the footer partition, relative to the header partition, or 0 if unknown.
+	FooterPartition uint64
+
+	HeaderByteCount uint64
+	IndexByteCount  uint64
+	IndexSID        uint32
+
+	// The position within the essence container of the first essence in this partition.
+	BodyOffset uint64
+	BodySID    uint32
+
+	OperationalPattern UL
+}
+
+// Returns true if the operational pattern is OP1a, i.e. a single item with a single package.
+func (p *Partition) IsOP1a() bool {
+	return p.OperationalPattern.hasPrefix(operationalPatternKey, 12) && p.OperationalPattern[12] == 1 && p.OperationalPattern[13] == 1
+}
+
+func (p *Partition) decode(buf []byte) error {
+	if len(buf) < 88 {
+		return fmt.Errorf("partition pack too short")
+	}
+	p.FooterPartition = binary.BigEndian.Uint64(buf[24:])
+	p.HeaderByteCount = binary.BigEndian.Uint64(buf[32:])
+	p.IndexByteCount = binary.BigEndian.Uint64(buf[40:])
+	p.IndexSID = binary.BigEndian.Uint32(buf[48:])
+	p.BodyOffset = binary.BigEndian.Uint64(buf[52:])
+	p.BodySID = binary.BigEndian.Uint32(buf[60:])
+	copy(p.OperationalPattern[:], buf[64:80])
+	return nil
+}
+
+// Rational is a fraction such as an edit rate or aspect ratio.
+type Rational struct {
+	Numerator   int32
+	Denominator int32
+}
+
+// Calls f for each item of a local set.
+func forEachLocalItem(buf []byte, f func(tag uint16, value []byte) error) error {
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return fmt.Errorf("truncated local set item")
+		}
+		tag := binary.BigEndian.Uint16(buf)
+		length := int(binary.BigEndian.Uint16(buf[2:]))
+		if len(buf)-4 < length {
+			return fmt.Errorf("truncated local set item")
+		}
+		if err := f(tag, buf[4:4+length]); err != nil {
+			return err
+		}
+		buf = buf[4+length:]
+	}
+	return nil
+}
+
+// Local set items are rejected if they're shorter than their type requires.
+func localUint32(tag uint16, v []byte) (uint32, error) {
+	if len(v) < 4 {
+		return 0, fmt.Errorf("item %#04x too short", tag)
+	}
+	return binary.BigEndian.Uint32(v), nil
+}
+
+func localInt64(tag uint16, v []byte) (int64, error) {
+	if len(v) < 8 {
+		return 0, fmt.Errorf("item %#04x too short", tag)
+	}
+	return int64(binary.BigEndian.Uint64(v)), nil
+}
+
+func localRational(tag uint16, v []byte) (Rational, error) {
+	if len(v) < 8 {
+		return Rational{}, fmt.Errorf("item %#04x too short", tag)
+	}
+	return Rational{
+		Numerator:   int32(binary.BigEndian.Uint32(v)),
+		Denominator: int32(binary.BigEndian.Uint32(v[4:])),
+	}, nil
+}
+
+// PictureDescriptor holds the fields of the CDCI (or RGBA) picture essence descriptor that are
+// relevant to ProRes essence.
+type PictureDescriptor struct {
+	SampleRate        Rational
+	ContainerDuration int64
+	EssenceContainer  UL
+
+	// FrameLayout is 0 for full frames and 1 for separate fields.
+	FrameLayout   int
+	StoredWidth   int
+	StoredHeight  int
+	AspectRatio   Rational
+	LinkedTrackID uint32
+
+	PictureEssenceCoding UL
+
+	ComponentDepth        int
+	HorizontalSubsampling int
+	VerticalSubsampling   int
+}
+
+// Returns the ProRes fourcc that corresponds to the picture essence coding, such as "apch", or an
+// empty string if the essence isn't ProRes.
+func (d *PictureDescriptor) FourCC() string {
+	if !d.PictureEssenceCoding.hasPrefix(proResPictureEssenceCodingKey, 14) {
+		return ""
+	}
+	if profile := int(d.PictureEssenceCoding[14]); profile < len(proResFourCCs) {
+		return proResFourCCs[profile]
+	}
+	return ""
+}
+
+func (d *PictureDescriptor) decode(buf []byte) error {
+	return forEachLocalItem(buf, func(tag uint16, v []byte) error {
+		var err error
+		var u32 uint32
+		switch tag {
+		case 0x3001:
+			d.SampleRate, err = localRational(tag, v)
+		case 0x3002:
+			d.ContainerDuration, err = localInt64(tag, v)
+		case 0x3004:
+			if len(v) < 16 {
+				return fmt.Errorf("item %#04x too short", tag)
+			}
+			copy(d.EssenceContainer[:], v)
+		case 0x3006:
+			d.LinkedTrackID, err = localUint32(tag, v)
+		case 0x320c:
+			if len(v) < 1 {
+				return fmt.Errorf("item %#04x too short", tag)
+			}
+			d.FrameLayout = int(v[0])
+		case 0x3202:
+			u32, err = localUint32(tag, v)
+			d.StoredHeight = int(u32)
+		case 0x3203:
+			u32, err = localUint32(tag, v)
+			d.StoredWidth = int(u32)
+		case 0x320e:
+			d.AspectRatio, err = localRational(tag, v)
+		case 0x3201:
+			if len(v) < 16 {
+				return fmt.Errorf("item %#04x too short", tag)
+			}
+			copy(d.PictureEssenceCoding[:], v)
+		case 0x3301:
+			u32, err = localUint32(tag, v)
+			d.ComponentDepth = int(u32)
+		case 0x3302:
+			u32, err = localUint32(tag, v)
+			d.HorizontalSubsampling = int(u32)
+		case 0x3308:
+			u32, err = localUint32(tag, v)
+			d.VerticalSubsampling = int(u32)
+		}
+		return err
+	})
+}
+
+// indexTableSegment holds the fields of an index table segment needed to locate frames.
+type indexTableSegment struct {
+	EditRate          Rational
+	StartPosition     int64
+	Duration          int64
+	EditUnitByteCount uint32
+	IndexSID          uint32
+	BodySID           uint32
+
+	// For variable size edit units, the stream offset of each edit unit.
+	StreamOffsets []uint64
+}
+
+func (s *indexTableSegment) decode(buf []byte) error {
+	var sliceCount, posTableCount int
+	var entries []byte
+	if err := forEachLocalItem(buf, func(tag uint16, v []byte) error {
+		var err error
+		switch tag {
+		case 0x3f0b:
+			s.EditRate, err = localRational(tag, v)
+		case 0x3f0c:
+			s.StartPosition, err = localInt64(tag, v)
+		case 0x3f0d:
+			s.Duration, err = localInt64(tag, v)
+		case 0x3f05:
+			s.EditUnitByteCount, err = localUint32(tag, v)
+		case 0x3f06:
+			s.IndexSID, err = localUint32(tag, v)
+		case 0x3f07:
+			s.BodySID, err = localUint32(tag, v)
+		case 0x3f08:
+			if len(v) < 1 {
+				return fmt.Errorf("item %#04x too short", tag)
+			}
+			sliceCount = int(v[0])
+		case 0x3f0e:
+			if len(v) < 1 {
+				return fmt.Errorf("item %#04x too short", tag)
+			}
+			posTableCount = int(v[0])
+		case 0x3f0a:
+			entries = v
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if entries == nil {
+		return nil
+	} else if len(entries) < 8 {
+		return fmt.Errorf("index entry array too short")
+	}
+	count := int(binary.BigEndian.Uint32(entries))
+	entrySize := int(binary.BigEndian.Uint32(entries[4:]))
+	if minSize := 11 + 4*sliceCount + 8*posTableCount; entrySize < minSize {
+		return fmt.Errorf("invalid index entry size")
+	} else if uint64(count)*uint64(entrySize) > uint64(len(entries)-8) {
+		return fmt.Errorf("index entry array too short")
+	}
+	s.StreamOffsets = make([]uint64, count)
+	for i := range s.StreamOffsets {
+		s.StreamOffsets[i] = binary.BigEndian.Uint64(entries[8+i*entrySize+3:])
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package mxf reads frame-wrapped ProRes essence from MXF OP1a files, as mapped by SMPTE RDD 44.
+package mxf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The largest header metadata set or index table segment that will be read.
+const maxMetadataLength = 64 << 20
+
+// The maximum size of a run-in before the header partition pack.
+const maxRunInLength = 64 << 10
+
+// Reader provides access to the ProRes frames of an MXF file.
+type Reader struct {
+	Partitions []Partition
+
+	// The descriptor of the picture essence. If the file doesn't contain one, this is nil.
+	Descriptor *PictureDescriptor
+
+	r      io.ReaderAt
+	frames []essenceElement
+}
+
+type essenceElement struct {
+	BodySID      uint32
+	StreamOffset uint64
+	Offset       int64
+	Length       int64
+}
+
+// Parses the file's partitions, header metadata, and index tables. Every KLV triplet's key is
+// read, but the essence itself is only read on demand.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	offset, err := findHeaderPartition(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &Reader{
+		r: r,
+	}
+
+	var elements []essenceElement
+	var segments []*indexTableSegment
+
+	// The position within the essence container of the next essence triplet, and whether or not
+	// essence has been encountered in the current partition yet.
+	var streamOffset uint64
+	inEssence := false
+
+	for offset < size {
+		k, err := readKLV(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		offset = k.end()
+
+		switch {
+		case k.Key.hasPrefix(partitionPackKey, 13) && k.Key[13] >= 2 && k.Key[13] <= 4:
+			buf, err := k.read(r, maxMetadataLength)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read partition pack: %w", err)
+			}
+			p := Partition{
+				Kind:   PartitionKind(k.Key[13]),
+				Offset: k.Start,
+			}
+			if err := p.decode(buf); err != nil {
+				return nil, err
+			}
+			ret.Partitions = append(ret.Partitions, p)
+			streamOffset = p.BodyOffset
+			inEssence = false
+		case k.Key.Equivalent(randomIndexPackKey):
+			offset = size
+		case k.Key.Equivalent(indexTableSegmentKey):
+			buf, err := k.read(r, maxMetadataLength)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read index table segment: %w", err)
+			}
+			segment := &indexTableSegment{}
+			if err := segment.decode(buf); err != nil {
+				return nil, fmt.Errorf("unable to decode index table segment: %w", err)
+			}
+			segments = append(segments, segment)
+		case k.Key.hasPrefix(metadataSetKey, 13):
+			setID := binary.BigEndian.Uint16(k.Key[13:])
+			if ret.Descriptor != nil || (setID != cdciDescriptorSetID && setID != rgbaDescriptorSetID) {
+				break
+			}
+			buf, err := k.read(r, maxMetadataLength)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read picture descriptor: %w", err)
+			}
+			descriptor := &PictureDescriptor{}
+			if err := descriptor.decode(buf); err != nil {
+				return nil, fmt.Errorf("unable to decode picture descriptor: %w", err)
+			}
+			ret.Descriptor = descriptor
+		case k.Key.hasPrefix(pictureItemKey, 13):
+			if len(ret.Partitions) == 0 {
+				return nil, fmt.Errorf("essence precedes the header partition")
+			}
+			elements = append(elements, essenceElement{
+				BodySID:      ret.Partitions[len(ret.Partitions)-1].BodySID,
+				StreamOffset: streamOffset,
+				Offset:       k.Offset,
+				Length:       k.Length,
+			})
+			inEssence = true
+		}
+
+		if inEssence {
+			// Fill and other triplets interleaved with the essence are part of the essence container
+			// too.
+			streamOffset += uint64(k.end() - k.Start)
+		}
+	}
+
+	if len(ret.Partitions) == 0 {
+		return nil, fmt.Errorf("header partition not found")
+	} else if !ret.Partitions[0].IsOP1a() {
+		return nil, fmt.Errorf("unsupported operational pattern %v", ret.Partitions[0].OperationalPattern)
+	}
+
+	if len(elements) > 0 {
+		if ret.frames, err = indexedFrames(elements, segments); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// Searches for the header partition pack, which may be preceded by a run-in.
+func findHeaderPartition(r io.ReaderAt, size int64) (int64, error) {
+	n := int64(maxRunInLength + 16)
+	if size < n {
+		n = size
+	}
+	buf := make([]byte, n)
+	if read, err := r.ReadAt(buf, 0); int64(read) < n {
+		return 0, err
+	}
+	if i := bytes.Index(buf, partitionPackKey[:11]); i >= 0 {
+		return int64(i), nil
+	}
+	return 0, fmt.Errorf("header partition not found")
+}
+
+// Returns the essence elements in edit unit order. If the file has index tables for the essence,
+// they're used to order the elements. Otherwise they're assumed to be stored in order.
+func indexedFrames(elements []essenceElement, segments []*indexTableSegment) ([]essenceElement, error) {
+	bodySID := elements[0].BodySID
+	byStreamOffset := make(map[uint64]int)
+	for i, e := range elements {
+		if e.BodySID == bodySID {
+			byStreamOffset[e.StreamOffset] = i
+		}
+	}
+
+	// Segments are repeated in later partitions, so only the first segment for each start position
+	// is used.
+	var relevant []*indexTableSegment
+	seen := make(map[int64]bool)
+	for _, s := range segments {
+		if s.BodySID == bodySID && !seen[s.StartPosition] {
+			seen[s.StartPosition] = true
+			relevant = append(relevant, s)
+		}
+	}
+	sort.Slice(relevant, func(i, j int) bool {
+		return relevant[i].StartPosition < relevant[j].StartPosition
+	})
+
+	var ret []essenceElement
+	for _, s := range relevant {
+		if s.StartPosition != int64(len(ret)) {
+			return nil, fmt.Errorf("index table segments aren't contiguous")
+		}
+
+		if s.EditUnitByteCount != 0 {
+			if s.Duration < 0 || s.Duration > int64(len(elements)) {
+				return nil, fmt.Errorf("invalid index table segment duration")
+			}
+			for i := int64(0); i < s.Duration; i++ {
+				j, ok := byStreamOffset[uint64(s.StartPosition+i)*uint64(s.EditUnitByteCount)]
+				if !ok {
+					return nil, fmt.Errorf("index entry %v doesn't refer to an essence element", s.StartPosition+i)
+				}
+				ret = append(ret, elements[j])
+			}
+			continue
+		}
+
+		for i, streamOffset := range s.StreamOffsets {
+			j, ok := byStreamOffset[streamOffset]
+			if !ok {
+				return nil, fmt.Errorf("index entry %v doesn't refer to an essence element", s.StartPosition+int64(i))
+			}
+			ret = append(ret, elements[j])
+		}
+	}
+
+	if len(relevant) == 0 {
+		for _, e := range elements {
+			if e.BodySID == bodySID {
+				ret = append(ret, e)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// Returns the number of frames in the file.
+func (r *Reader) NumFrames() int {
+	return len(r.frames)
+}
+
+// Returns a reader for the nth frame's essence, which can be passed directly to prores.DecodeFrame.
+func (r *Reader) Frame(n int) (*io.SectionReader, error) {
+	if n < 0 || n >= len(r.frames) {
+		return nil, fmt.Errorf("frame %v out of range", n)
+	}
+	f := &r.frames[n]
+	return io.NewSectionReader(r.r, f.Offset, f.Length), nil
+}
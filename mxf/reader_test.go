@@ -0,0 +1,200 @@
+package mxf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	prores "github.com/theaaf/prores-go"
+)
+
+var (
+	testOP1a            = UL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x01, 0x09, 0x00}
+	testFillKey         = UL{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x01, 0x01, 0x02, 0x03, 0x01, 0x02, 0x10, 0x01, 0x00, 0x00, 0x00}
+	testEssenceKey      = UL{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x02, 0x01, 0x01, 0x0d, 0x01, 0x03, 0x01, 0x15, 0x01, 0x17, 0x01}
+	testCDCIKey         = UL{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x01, 0x01, 0x01, 0x01, 0x28, 0x00}
+	testHQEssenceCoding = UL{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x0d, 0x04, 0x01, 0x02, 0x02, 0x03, 0x06, 0x04, 0x00}
+)
+
+func testKLV(key UL, value ...[]byte) []byte {
+	v := bytes.Join(value, nil)
+	ret := append([]byte(nil), key[:]...)
+	ret = append(ret, 0x83, byte(len(v)>>16), byte(len(v)>>8), byte(len(v)))
+	return append(ret, v...)
+}
+
+func testUint16(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func testUint32(v uint32) []byte {
+	ret := make([]byte, 4)
+	binary.BigEndian.PutUint32(ret, v)
+	return ret
+}
+
+func testUint64(v uint64) []byte {
+	ret := make([]byte, 8)
+	binary.BigEndian.PutUint64(ret, v)
+	return ret
+}
+
+func testLocalItem(tag uint16, value ...[]byte) []byte {
+	v := bytes.Join(value, nil)
+	return append(append(testUint16(tag), testUint16(uint16(len(v)))...), v...)
+}
+
+func testPartitionPack(kind PartitionKind, indexSID uint32, bodyOffset uint64, bodySID uint32) []byte {
+	key := partitionPackKey
+	key[13] = byte(kind)
+	key[14] = 0x04 // closed and complete
+	return testKLV(key,
+		testUint16(1), testUint16(3), testUint32(1),
+		testUint64(0), testUint64(0), testUint64(0), testUint64(0), testUint64(0),
+		testUint32(indexSID), testUint64(bodyOffset), testUint32(bodySID),
+		testOP1a[:],
+		testUint32(0), testUint32(16),
+	)
+}
+
+func testIndexTableSegment(bodySID uint32, startPosition int64, streamOffsets ...uint64) []byte {
+	var entries [][]byte
+	for _, offset := range streamOffsets {
+		entries = append(entries, []byte{0, 0, 0x80}, testUint64(offset))
+	}
+	return testKLV(indexTableSegmentKey,
+		testLocalItem(0x3f0b, testUint32(30000), testUint32(1001)),
+		testLocalItem(0x3f0c, testUint64(uint64(startPosition))),
+		testLocalItem(0x3f0d, testUint64(uint64(len(streamOffsets)))),
+		testLocalItem(0x3f05, testUint32(0)),
+		testLocalItem(0x3f06, testUint32(2)),
+		testLocalItem(0x3f07, testUint32(bodySID)),
+		testLocalItem(0x3f0a, testUint32(uint32(len(streamOffsets))), testUint32(11), bytes.Join(entries, nil)),
+	)
+}
+
+// Builds an OP1a file whose essence is split across two body partitions. If withIndex is true, the
+// footer partition contains an index table.
+func testFile(frames [][]byte, withIndex bool) []byte {
+	header := bytes.Join([][]byte{
+		testPartitionPack(PartitionKindHeader, 0, 0, 0),
+		testKLV(primerPackKey, testUint32(0), testUint32(18)),
+		testKLV(testCDCIKey,
+			testLocalItem(0x3001, testUint32(30000), testUint32(1001)),
+			testLocalItem(0x3002, testUint64(uint64(len(frames)))),
+			testLocalItem(0x320c, []byte{0}),
+			testLocalItem(0x3202, testUint32(1080)),
+			testLocalItem(0x3203, testUint32(1920)),
+			testLocalItem(0x320e, testUint32(16), testUint32(9)),
+			testLocalItem(0x3201, testHQEssenceCoding[:]),
+			testLocalItem(0x3301, testUint32(10)),
+			testLocalItem(0x3302, testUint32(2)),
+			testLocalItem(0x3308, testUint32(1)),
+		),
+	}, nil)
+
+	var streamOffsets []uint64
+	var streamOffset uint64
+
+	var body []byte
+	for i, frame := range frames {
+		if i == 0 || i == 2 {
+			body = append(body, testPartitionPack(PartitionKindBody, 0, streamOffset, 1)...)
+		}
+		streamOffsets = append(streamOffsets, streamOffset)
+		element := testKLV(testEssenceKey, frame)
+		body = append(body, element...)
+		streamOffset += uint64(len(element))
+		if i == 0 {
+			fill := testKLV(testFillKey, make([]byte, 7))
+			body = append(body, fill...)
+			streamOffset += uint64(len(fill))
+		}
+	}
+
+	footer := testPartitionPack(PartitionKindFooter, 2, streamOffset, 0)
+	if withIndex {
+		footer = append(footer, testIndexTableSegment(1, 0, streamOffsets...)...)
+	}
+	footer = append(footer, testKLV(randomIndexPackKey, make([]byte, 4))...)
+
+	return bytes.Join([][]byte{header, body, footer}, nil)
+}
+
+func TestReader(t *testing.T) {
+	frame, err := ioutil.ReadFile("../testdata/skycam-frame.icpf")
+	require.NoError(t, err)
+	frames := [][]byte{[]byte("foo"), frame, []byte("barbaz"), []byte("qux")}
+
+	for _, withIndex := range []bool{false, true} {
+		file := testFile(frames, withIndex)
+		r, err := NewReader(bytes.NewReader(file), int64(len(file)))
+		require.NoError(t, err)
+
+		require.Len(t, r.Partitions, 4)
+		assert.Equal(t, PartitionKindHeader, r.Partitions[0].Kind)
+		assert.True(t, r.Partitions[0].IsOP1a())
+		assert.Equal(t, PartitionKindFooter, r.Partitions[3].Kind)
+
+		require.NotNil(t, r.Descriptor)
+		assert.Equal(t, "apch", r.Descriptor.FourCC())
+		assert.Equal(t, 1920, r.Descriptor.StoredWidth)
+		assert.Equal(t, 1080, r.Descriptor.StoredHeight)
+		assert.Equal(t, Rational{30000, 1001}, r.Descriptor.SampleRate)
+		assert.Equal(t, Rational{16, 9}, r.Descriptor.AspectRatio)
+		assert.Equal(t, 10, r.Descriptor.ComponentDepth)
+		assert.Equal(t, 2, r.Descriptor.HorizontalSubsampling)
+		assert.EqualValues(t, len(frames), r.Descriptor.ContainerDuration)
+
+		require.Equal(t, len(frames), r.NumFrames())
+		for i, expected := range frames {
+			sr, err := r.Frame(i)
+			require.NoError(t, err)
+			actual, err := ioutil.ReadAll(sr)
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		}
+		_, err = r.Frame(len(frames))
+		assert.Error(t, err)
+
+		sr, err := r.Frame(1)
+		require.NoError(t, err)
+		img, err := prores.DecodeFrame(sr, sr.Size())
+		require.NoError(t, err)
+		assert.Equal(t, 1920, img.Bounds().Dx())
+	}
+}
+
+func TestReader_RunIn(t *testing.T) {
+	file := append(make([]byte, 100), testFile([][]byte{[]byte("a"), []byte("b"), []byte("c")}, true)...)
+	r, err := NewReader(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, r.Partitions[0].Offset)
+	assert.Equal(t, 3, r.NumFrames())
+}
+
+func TestReader_InvalidIndex(t *testing.T) {
+	file := testFile([][]byte{[]byte("a"), []byte("b"), []byte("c")}, false)
+	rip := testKLV(randomIndexPackKey, make([]byte, 4))
+	file = append(file[:len(file)-len(rip)], testIndexTableSegment(1, 0, 0, 1, 2)...)
+	_, err := NewReader(bytes.NewReader(file), int64(len(file)))
+	assert.Error(t, err)
+}
+
+func TestReader_Malformed(t *testing.T) {
+	file := testFile([][]byte{[]byte("a"), []byte("b"), []byte("c")}, true)
+
+	// Truncations and corrupt fields should produce errors rather than panics.
+	for i := 0; i < len(file); i++ {
+		NewReader(bytes.NewReader(file[:i]), int64(i))
+	}
+	for i := 0; i+4 <= len(file); i++ {
+		corrupted := append([]byte(nil), file...)
+		binary.BigEndian.PutUint32(corrupted[i:], 0xffffffff)
+		NewReader(bytes.NewReader(corrupted), int64(len(corrupted)))
+	}
+}
@@ -1,18 +1,26 @@
 package prores
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"image"
 	"io"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 )
 
 const MacroblockWidth = 16
 const MacroblockHeight = 16
 
 type PictureHeader struct {
-	HeaderSize        int64
+	HeaderSize int64
+
+	// The size of the picture in bytes, including the header.
+	PictureSize int64
+
 	NumberOfSlices    int
 	SliceWidthFactor  int
 	SliceHeightFactor int
@@ -26,27 +34,63 @@ func (h *PictureHeader) SliceHeightMacroblocks() int {
 	return 1 << uint(h.SliceHeightFactor)
 }
 
+// The largest and smallest picture header sizes that can be coded.
+const (
+	maxPictureHeaderSize = 0xff / 8
+	minPictureHeaderSize = 64 / 8
+)
+
+// Returns the size in bytes of a picture header given its first byte.
+func pictureHeaderSize(b byte) (int, error) {
+	if b < 64 {
+		return 0, fmt.Errorf("%w: picture header size must be at least 64", ErrInvalidHeader)
+	} else if b%8 != 0 {
+		return 0, fmt.Errorf("%w: picture header size not divisible by 8", ErrInvalidHeader)
+	}
+	return int(b / 8), nil
+}
+
 func (h *PictureHeader) Decode(r io.ReaderAt) error {
-	var hdrSizeBuf [1]byte
-	if _, err := r.ReadAt(hdrSizeBuf[:], 0); err != nil {
+	var buf [maxPictureHeaderSize]byte
+	return h.decode(unboundedReaderData(r), &buf)
+}
+
+// Like Decode, but decodes the header from the beginning of data. If data isn't in memory, the header
+// is read into buf.
+func (h *PictureHeader) decode(data encodedData, buf *[maxPictureHeaderSize]byte) error {
+	b, err := data.bytes(0, 1, buf[:])
+	if err != nil {
 		return err
 	}
 
-	if hdrSizeBuf[0] < 64 {
-		return fmt.Errorf("picture header size must be at least 64")
-	} else if hdrSizeBuf[0]%8 != 0 {
-		return fmt.Errorf("picture header size not divisible by 8")
+	hdrSize, err := pictureHeaderSize(b[0])
+	if err != nil {
+		return err
 	}
 
-	hdrSize := hdrSizeBuf[0] / 8
+	b, err = data.bytes(0, int64(hdrSize), buf[:])
+	if err != nil {
+		return err
+	}
+	return h.decodeBytes(b)
+}
 
-	buf := make([]byte, hdrSize)
-	if _, err := r.ReadAt(buf, 0); err != nil {
+// Like Decode, but decodes the header from the beginning of b.
+func (h *PictureHeader) decodeBytes(b []byte) error {
+	if len(b) == 0 {
+		return errUnexpectedEOF
+	}
+	hdrSize, err := pictureHeaderSize(b[0])
+	if err != nil {
 		return err
+	} else if len(b) < hdrSize {
+		return errUnexpectedEOF
 	}
+	buf := b[:hdrSize]
 
 	decoded := PictureHeader{
 		HeaderSize:        int64(hdrSize),
+		PictureSize:       int64(binary.BigEndian.Uint32(buf[1:])),
 		NumberOfSlices:    int(binary.BigEndian.Uint16(buf[5:])),
 		SliceWidthFactor:  int(buf[7] >> 4),
 		SliceHeightFactor: int(buf[7] & 0x0f),
@@ -78,7 +122,107 @@ var InterlacedScanOrder = []int{
 	46, 39, 47, 54, 61, 62, 55, 63,
 }
 
+// The state shared by the slices of a picture while it's being decoded.
+type pictureDecode struct {
+	ctx         context.Context
+	data        encodedData
+	frameHeader *FrameHeader
+	writers     sliceWriters
+	bounds      image.Rectangle
+	scanOrder   []int
+	sliceHeight int
+
+	// These are reused for each picture.
+	headerBuf  [maxPictureHeaderSize]byte
+	indexTable []byte
+
+	// Done once for each dispatched slice.
+	wg sync.WaitGroup
+
+	// Set when the first slice error is recorded so that the remaining slices can be abandoned.
+	failed atomic.Bool
+	errMu  sync.Mutex
+	err    error
+
+	// If not nil, slices that can't be decoded are concealed instead of failing the picture.
+	concealment *Concealment
+
+	// The writers for the previous frame if damaged slices are concealed with it.
+	previous sliceWriters
+
+	// The index of the picture within its frame.
+	index int
+
+	// If positive, pictures with more slices than this are rejected.
+	maxSlices int
+
+	// The slices that couldn't be decoded. Guarded by errMu.
+	damaged []DamagedSlice
+}
+
+func (p *pictureDecode) stopped() bool {
+	return p.failed.Load() || p.ctx.Err() != nil
+}
+
+func (p *pictureDecode) fail(err error) {
+	p.errMu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.errMu.Unlock()
+	p.failed.Store(true)
+}
+
+func (p *pictureDecode) decodeSlice(decoder *SliceDecoder, job *decodeSliceJob) {
+	// Once we've stopped, the remaining slices are drained without being decoded.
+	if p.stopped() {
+		return
+	}
+	rect := image.Rect(job.x, job.y, job.x+job.width, job.y+p.sliceHeight).Intersect(p.bounds)
+
+	// A panic here would take down the whole process, and it could only be caused by data that
+	// isn't validated well enough, so it's treated like any other error.
+	defer func() {
+		if r := recover(); r != nil {
+			p.damage(job, rect, p.sliceError(job, &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}))
+		}
+	}()
+
+	buf, data, err := decoder.readData(p.data, job.offset, job.dataLen)
+	if err != nil {
+		p.damage(job, rect, p.sliceError(job, err))
+		return
+	}
+	if buf != nil {
+		defer decoder.dataBuffers.Put(buf)
+	}
+
+	if err := decoder.decodeSlice(data, p.frameHeader, &p.writers, rect, p.scanOrder); err != nil {
+		p.damage(job, rect, p.sliceError(job, err))
+	}
+}
+
+// Returns a *SliceError that identifies the slice that failed with err.
+func (p *pictureDecode) sliceError(job *decodeSliceJob, err error) error {
+	var sliceErr *SliceError
+	if !errors.As(err, &sliceErr) {
+		sliceErr = &SliceError{
+			X:   job.x / MacroblockWidth,
+			Y:   job.y / MacroblockHeight,
+			Err: err,
+		}
+	}
+	sliceErr.Picture = p.index
+	sliceErr.Slice = job.index
+	return sliceErr
+}
+
 type decodeSliceJob struct {
+	picture *pictureDecode
+	index   int
 	offset  int64
 	x       int
 	y       int
@@ -93,111 +237,221 @@ const (
 	FieldOrderSecond FieldOrder = 2
 )
 
-func DecodePicture(r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder) (image.Image, error) {
-	if frameHeader.AlphaInfo.HasAlpha() {
-		return nil, fmt.Errorf("alpha channels not supported")
+// The images that pictures can be decoded into.
+type pictureImage interface {
+	image.Image
+	SubImage(image.Rectangle) image.Image
+}
+
+func newPictureImage(frameHeader *FrameHeader, bounds image.Rectangle, highBitDepth bool) pictureImage {
+	switch {
+	case highBitDepth && frameHeader.AlphaInfo.HasAlpha():
+		return NewNYCbCrA16(bounds, frameHeader.Flags.SubsampleRatio(), frameHeader.BitDepth())
+	case highBitDepth:
+		return NewYCbCr16(bounds, frameHeader.Flags.SubsampleRatio(), frameHeader.BitDepth())
+	case frameHeader.AlphaInfo.HasAlpha():
+		return image.NewNYCbCrA(bounds, frameHeader.Flags.SubsampleRatio())
 	}
+	return image.NewYCbCr(bounds, frameHeader.Flags.SubsampleRatio())
+}
 
-	scanOrder := ProgressiveScanOrder
+// Returns the height of the given picture. For interlaced frames, this is the height of a field.
+func pictureHeight(frameHeader *FrameHeader, fieldOrder FieldOrder) int {
 	height := frameHeader.Height
-
 	switch frameHeader.Flags.InterlaceMode() {
 	case InterlaceModeTopFirst:
-		scanOrder = InterlacedScanOrder
 		if fieldOrder == FieldOrderFirst {
-			height = (height + 1) / 2
-		} else {
-			height = height / 2
+			return (height + 1) / 2
 		}
+		return height / 2
 	case InterlaceModeTopSecond:
-		scanOrder = InterlacedScanOrder
 		if fieldOrder == FieldOrderFirst {
-			height = height / 2
-		} else {
-			height = (height + 1) / 2
+			return height / 2
 		}
+		return (height + 1) / 2
 	}
+	return height
+}
 
-	widthMacroblocks := (frameHeader.Width + MacroblockWidth - 1) / MacroblockWidth
+// Returns the bounds of the image that a picture with the given dimensions is decoded into. The
+// bounds are rounded up to the nearest macroblock.
+func macroblockBounds(width, height int) image.Rectangle {
+	widthMacroblocks := (width + MacroblockWidth - 1) / MacroblockWidth
 	heightMacroblocks := (height + MacroblockHeight - 1) / MacroblockHeight
-	img := image.NewYCbCr(image.Rect(0, 0, widthMacroblocks*MacroblockWidth, heightMacroblocks*MacroblockHeight), frameHeader.Flags.SubsampleRatio())
+	return image.Rect(0, 0, widthMacroblocks*MacroblockWidth, heightMacroblocks*MacroblockHeight)
+}
 
-	var header PictureHeader
-	if err := header.Decode(r); err != nil {
+// Decodes a picture into an 8-bit image. If the frame has an alpha channel, the result is an
+// *image.NYCbCrA. Otherwise it's an *image.YCbCr.
+func DecodePicture(r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder) (image.Image, error) {
+	return defaultDecoder().DecodePicture(r, frameHeader, fieldOrder)
+}
+
+// Decodes a picture without truncating samples to 8 bits. The samples are given the precision
+// returned by FrameHeader.BitDepth. If the frame has an alpha channel, the result is a *NYCbCrA16.
+// Otherwise it's a *YCbCr16.
+func DecodePicture16(r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder) (image.Image, error) {
+	return defaultDecoder().DecodePicture16(r, frameHeader, fieldOrder)
+}
+
+func (d *Decoder) decodePicture(ctx context.Context, r io.ReaderAt, frameHeader *FrameHeader, fieldOrder FieldOrder, highBitDepth bool) (image.Image, error) {
+	bounds := macroblockBounds(frameHeader.Width, pictureHeight(frameHeader, fieldOrder))
+	img := newPictureImage(frameHeader, bounds, highBitDepth)
+	writers, err := newSliceWriters(img)
+	if err != nil {
 		return nil, err
 	}
 
-	indexTableBuf := make([]byte, 2*header.NumberOfSlices)
-	if _, err := r.ReadAt(indexTableBuf, header.HeaderSize); err != nil {
+	f := d.getFrameDecode()
+	defer d.putFrameDecode(f)
+
+	f.picture.index = int(fieldOrder) - 1
+	f.picture.maxSlices = 0
+	if err := d.decodePictureInto(ctx, &f.picture, &writers, bounds, unboundedReaderData(r), frameHeader); err != nil {
 		return nil, err
 	}
+	return img.SubImage(image.Rect(0, 0, frameHeader.Width, bounds.Dy())), nil
+}
+
+// Decodes a picture using writers. bounds is the picture's size, rounded up to the nearest macroblock.
+// Decoding stops at the first slice that fails or as soon as ctx is done, in which case ctx.Err() is
+// returned. The state in picture is overwritten.
+func (d *Decoder) decodePictureInto(ctx context.Context, picture *pictureDecode, writers *sliceWriters, bounds image.Rectangle, data encodedData, frameHeader *FrameHeader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	scanOrder := ProgressiveScanOrder
+	if frameHeader.Flags.InterlaceMode() != InterlaceModeNone {
+		scanOrder = InterlacedScanOrder
+	}
+
+	var header PictureHeader
+	if err := header.decode(data, &picture.headerBuf); err != nil {
+		return err
+	}
+	if header.SliceWidthMacroblocks() > MaxMacroblocksPerSlice {
+		return fmt.Errorf("%w: slices %v macroblocks wide", ErrUnsupported, header.SliceWidthMacroblocks())
+	} else if header.SliceHeightFactor > maxSliceHeightFactor {
+		return fmt.Errorf("%w: slices %v macroblocks tall", ErrUnsupported, header.SliceHeightMacroblocks())
+	}
+	if picture.maxSlices > 0 && header.NumberOfSlices > picture.maxSlices {
+		return fmt.Errorf("%w: picture has %v slices, which is more than %v", ErrLimitExceeded, header.NumberOfSlices, picture.maxSlices)
+	}
 
+	// Every slice must be within the picture. A picture may have fewer slices than it needs to cover
+	// it, in which case the rest of it isn't decoded.
 	sliceHeight := header.SliceHeightMacroblocks() * MacroblockHeight
+	if maxSlices := maxSlicesPerPicture(frameHeader.Width, bounds.Dy(), header.SliceWidthMacroblocks()*MacroblockWidth, sliceHeight); header.NumberOfSlices > maxSlices {
+		return fmt.Errorf("%w: picture has %v slices, but only %v fit in it", ErrInvalidHeader, header.NumberOfSlices, maxSlices)
+	}
 
-	jobCh := make(chan *decodeSliceJob, header.NumberOfSlices)
-	errCh := make(chan error, 1)
-
-	var wg sync.WaitGroup
-
-	const numberOfWorkers = 8
-
-	wg.Add(numberOfWorkers)
-	for i := 0; i < numberOfWorkers; i++ {
-		go func() {
-			defer wg.Done()
-			decoder := NewSliceDecoder()
-			for {
-				job := <-jobCh
-				if job == nil {
-					return
-				}
-				r := io.NewSectionReader(r, job.offset, job.dataLen)
-				rect := image.Rect(job.x, job.y, job.x+job.width, job.y+sliceHeight).Intersect(img.Bounds())
-				if err := decoder.DecodeSlice(r, frameHeader, img, rect, scanOrder); err != nil {
-					select {
-					case errCh <- err:
-					default:
-					}
-				}
-			}
-		}()
+	indexTableSize := 2 * header.NumberOfSlices
+	if data.b == nil && cap(picture.indexTable) < indexTableSize {
+		picture.indexTable = make([]byte, indexTableSize)
+	}
+	indexTable, err := data.bytes(header.HeaderSize, int64(indexTableSize), picture.indexTable[:cap(picture.indexTable)])
+	if err != nil {
+		return err
 	}
 
-	offset := header.HeaderSize + int64(len(indexTableBuf))
+	picture.ctx = ctx
+	picture.data = data
+	picture.frameHeader = frameHeader
+	picture.writers = *writers
+	picture.bounds = bounds
+	picture.scanOrder = scanOrder
+	picture.sliceHeight = sliceHeight
+	picture.failed.Store(false)
+	picture.err = nil
+
+	offset := header.HeaderSize + int64(len(indexTable))
 	x := 0
 	y := 0
 
+dispatch:
 	for i := 0; i < header.NumberOfSlices; i++ {
-		sliceDataLen := int64(binary.BigEndian.Uint16(indexTableBuf[i*2:]))
-		sliceWidth := header.SliceWidthMacroblocks() * MacroblockWidth
-		for sliceWidth > MacroblockWidth && x+sliceWidth > frameHeader.Width {
-			sliceWidth >>= 1
-		}
-		jobCh <- &decodeSliceJob{
+		sliceDataLen := int64(binary.BigEndian.Uint16(indexTable[i*2:]))
+		sliceWidth := sliceWidthAt(x, frameHeader.Width, header.SliceWidthMacroblocks()*MacroblockWidth)
+		job := decodeSliceJob{
+			picture: picture,
+			index:   i,
 			offset:  offset,
 			x:       x,
 			y:       y,
 			width:   sliceWidth,
 			dataLen: sliceDataLen,
 		}
+		if picture.stopped() {
+			break
+		} else if !writers.luma.intersects(x, y, sliceWidth, picture.sliceHeight) {
+			// The slice isn't in the region being decoded.
+		} else if d.jobs == nil {
+			picture.decodeSlice(d.sliceDecoder, &job)
+		} else {
+			picture.wg.Add(1)
+			select {
+			case d.jobs <- job:
+			case <-ctx.Done():
+				picture.wg.Done()
+				break dispatch
+			}
+		}
 		offset += sliceDataLen
 		x += sliceWidth
 		if x >= frameHeader.Width {
 			x = 0
-			y += sliceHeight
+			y += picture.sliceHeight
 		}
 	}
 
-	for i := 0; i < numberOfWorkers; i++ {
-		jobCh <- nil
+	picture.wg.Wait()
+
+	// Don't hang on to anything that the caller might not want us to.
+	picture.ctx = nil
+	picture.data = encodedData{}
+	picture.writers = sliceWriters{}
+
+	if err := ctx.Err(); err != nil {
+		picture.damaged = picture.damaged[:0]
+		return err
+	}
+	if picture.err != nil {
+		picture.damaged = picture.damaged[:0]
+		return picture.err
+	}
+	picture.conceal(writers)
+	return nil
+}
+
+// The largest slice height factor that's supported. Encoders always use 0.
+const maxSliceHeightFactor = 3
+
+// Returns the number of slices needed to cover a picture of the given size.
+func maxSlicesPerPicture(pictureWidth, pictureHeight, maxSliceWidth, sliceHeight int) int {
+	slicesPerRow := 0
+	for x := 0; x < pictureWidth; x += sliceWidthAt(x, pictureWidth, maxSliceWidth) {
+		slicesPerRow++
 	}
+	return slicesPerRow * ((pictureHeight + sliceHeight - 1) / sliceHeight)
+}
 
-	wg.Wait()
+// Returns the smallest number of bytes that a picture of the given size can be coded in. That's when
+// it has as few slices as possible, each of which still needs an index table entry and a header.
+// Returns false if even that would be more slices than a picture can have.
+func minPictureSize(width, height int) (int64, bool) {
+	slices := maxSlicesPerPicture(width, height, MaxMacroblocksPerSlice*MacroblockWidth, MacroblockHeight<<maxSliceHeightFactor)
+	return minPictureHeaderSize + int64(slices)*(2+minSliceHeaderSize), slices <= 0xffff
+}
 
-	select {
-	case err := <-errCh:
-		return nil, err
-	default:
+// Returns the width in pixels of the slice that starts at x. Slices are normally maxSliceWidth wide,
+// but at the right edge of the picture they're halved until they fit in the remaining macroblocks.
+// This is done in whole macroblocks, so a partial macroblock at the edge counts as a full one.
+func sliceWidthAt(x, pictureWidth, maxSliceWidth int) int {
+	remaining := macroblockBounds(pictureWidth, 0).Dx() - x
+	sliceWidth := maxSliceWidth
+	for sliceWidth > MacroblockWidth && sliceWidth > remaining {
+		sliceWidth >>= 1
 	}
-	return img.SubImage(image.Rect(0, 0, frameHeader.Width, height)), nil
+	return sliceWidth
 }
@@ -7,8 +7,6 @@ import (
 	"io"
 	"math/bits"
 	"sync"
-
-	"github.com/pkg/errors"
 )
 
 const (
@@ -24,26 +22,65 @@ type SliceHeader struct {
 	QuantizationIndex int
 	LumaDataSize      int
 	ChromaUDataSize   int
+
+	// Only present if HeaderSize is at least 8, which is the case for slices with alpha data. When
+	// it's present, the alpha data follows the chroma v data.
+	ChromaVDataSize int
+}
+
+func (h *SliceHeader) HasChromaVDataSize() bool {
+	return h.HeaderSize >= 8
+}
+
+// The smallest slice header size that can be coded.
+const minSliceHeaderSize = 48 / 8
+
+// Returns the size in bytes of a slice header given its first byte.
+func sliceHeaderSize(b byte) (int, error) {
+	if b < 48 {
+		return 0, fmt.Errorf("%w: slice header size must be at least 48", ErrInvalidHeader)
+	} else if b%8 != 0 {
+		return 0, fmt.Errorf("%w: slice header size not divisible by 8", ErrInvalidHeader)
+	}
+	return int(b / 8), nil
 }
 
 func (h *SliceHeader) Decode(r io.ReaderAt) error {
 	var hdrSizeBuf [1]byte
 	if _, err := r.ReadAt(hdrSizeBuf[:], 0); err != nil {
+		if err == io.EOF {
+			err = errUnexpectedEOF
+		}
 		return err
 	}
 
-	if hdrSizeBuf[0] < 48 {
-		return fmt.Errorf("slice header size must be at least 48")
-	} else if hdrSizeBuf[0]%8 != 0 {
-		return fmt.Errorf("slice header size not divisible by 8")
+	hdrSize, err := sliceHeaderSize(hdrSizeBuf[0])
+	if err != nil {
+		return err
 	}
 
-	hdrSize := hdrSizeBuf[0] / 8
-
 	buf := make([]byte, hdrSize)
 	if _, err := r.ReadAt(buf, 0); err != nil {
+		if err == io.EOF {
+			err = errUnexpectedEOF
+		}
+		return err
+	}
+	return h.decodeBytes(buf)
+}
+
+// Like Decode, but decodes the header from the beginning of b.
+func (h *SliceHeader) decodeBytes(b []byte) error {
+	if len(b) == 0 {
+		return errUnexpectedEOF
+	}
+	hdrSize, err := sliceHeaderSize(b[0])
+	if err != nil {
 		return err
+	} else if len(b) < hdrSize {
+		return errUnexpectedEOF
 	}
+	buf := b[:hdrSize]
 
 	decoded := SliceHeader{
 		HeaderSize:        int64(hdrSize),
@@ -51,6 +88,9 @@ func (h *SliceHeader) Decode(r io.ReaderAt) error {
 		LumaDataSize:      int(binary.BigEndian.Uint16(buf[2:])),
 		ChromaUDataSize:   int(binary.BigEndian.Uint16(buf[4:])),
 	}
+	if decoded.HasChromaVDataSize() {
+		decoded.ChromaVDataSize = int(binary.BigEndian.Uint16(buf[6:]))
+	}
 
 	*h = decoded
 	return nil
@@ -107,12 +147,32 @@ func (p CodeParameters) Decode(bs *Bitstream, dest *int) bool {
 	return true
 }
 
+// Writes v, which must not be negative, such that Decode reads it back.
+func (p CodeParameters) Encode(w *BitstreamWriter, v int) {
+	lastRiceQ := p.LastRiceQ()
+	riceOrder := uint(p.RiceOrder())
+	if riceThreshold := (lastRiceQ + 1) << riceOrder; v < riceThreshold {
+		// golomb-rice
+		w.WriteUnary(v >> riceOrder)
+		w.WriteInt(int(riceOrder), v)
+	} else {
+		// exponential-golomb
+		k := p.ExpOrder()
+		n := v - riceThreshold + 1<<uint(k)
+		exponent := bits.Len(uint(n)) - 1
+
+		// The unary terminator doubles as the most significant bit of n.
+		w.WriteUnary(exponent - k + lastRiceQ + 1)
+		w.WriteInt(exponent, n)
+	}
+}
+
 var dcCodeParams = [7]CodeParameters{0x04, 0x28, 0x28, 0x4D, 0x4D, 0x70, 0x70}
 
 func decodeDCCoefficients(bs *Bitstream, dest *[MaxBlocksPerSlice][64]int16, numberOfBlocks int) error {
 	var code int
 	if !CodeParameters(0xb8).Decode(bs, &code) {
-		return fmt.Errorf("unable to decode initial codeword")
+		return fmt.Errorf("%w: unable to decode initial codeword", ErrCorrupt)
 	}
 	prev := (((code) >> 1) ^ (-((code) & 1)))
 	dest[0][0] = int16(prev)
@@ -125,7 +185,7 @@ func decodeDCCoefficients(bs *Bitstream, dest *[MaxBlocksPerSlice][64]int16, num
 			params = dcCodeParams[code]
 		}
 		if !params.Decode(bs, &code) {
-			return fmt.Errorf("unable to decode codeword")
+			return fmt.Errorf("%w: unable to decode codeword", ErrCorrupt)
 		}
 		if code != 0 {
 			sign ^= -(code & 1)
@@ -156,7 +216,7 @@ func decodeACCoefficients(bs *Bitstream, dest *[MaxBlocksPerSlice][64]int16, num
 			params = acRunCodeParams[run]
 		}
 		if !params.Decode(bs, &run) {
-			return fmt.Errorf("unable to decode run bits")
+			return fmt.Errorf("%w: unable to decode run bits", ErrCorrupt)
 		}
 		pos += run + 1
 
@@ -165,19 +225,19 @@ func decodeACCoefficients(bs *Bitstream, dest *[MaxBlocksPerSlice][64]int16, num
 			params = acLevelCodeParams[level]
 		}
 		if !params.Decode(bs, &level) {
-			return fmt.Errorf("unable to decode level bits")
+			return fmt.Errorf("%w: unable to decode level bits", ErrCorrupt)
 		}
 		level += 1
 
-		block := pos & blockMask
-		if block >= numberOfBlocks {
-			return fmt.Errorf("invalid coefficient position")
+		if pos >= numberOfBlocks<<6 {
+			return fmt.Errorf("%w: invalid coefficient position", ErrCorrupt)
 		}
+		block := pos & blockMask
 		i := scanOrder[pos>>log2BlockCount]
 
 		var sign bool
 		if !bs.ReadBit(&sign) {
-			return fmt.Errorf("unable to decode sign")
+			return fmt.Errorf("%w: unable to decode sign", ErrCorrupt)
 		} else if sign {
 			dest[block][i] = int16(-level)
 		} else {
@@ -188,15 +248,14 @@ func decodeACCoefficients(bs *Bitstream, dest *[MaxBlocksPerSlice][64]int16, num
 	return nil
 }
 
-func (d *SliceDecoder) decodeCoefficients(coeffs *[MaxBlocksPerSlice][64]int16, b []byte, numberOfBlocks int, scanOrder []int) error {
-	bs := &Bitstream{
-		Bytes: b,
-	}
+// Decodes the coefficients of a channel from bs. If they can't be decoded, bs is left at the position
+// where the error was detected.
+func (d *SliceDecoder) decodeCoefficients(coeffs *[MaxBlocksPerSlice][64]int16, bs *Bitstream, numberOfBlocks int, scanOrder []int) error {
 	if err := decodeDCCoefficients(bs, coeffs, numberOfBlocks); err != nil {
-		return errors.Wrap(err, "unable to decode dc coefficients")
+		return fmt.Errorf("unable to decode dc coefficients: %w", err)
 	}
 	if err := decodeACCoefficients(bs, coeffs, numberOfBlocks, scanOrder); err != nil {
-		return errors.Wrap(err, "unable to decode ac coefficients")
+		return fmt.Errorf("unable to decode ac coefficients: %w", err)
 	}
 	return nil
 }
@@ -208,6 +267,13 @@ func clamp10bit(n int32) uint16 {
 	return uint16(n)
 }
 
+func clampBits(n int32, bitDepth uint) uint16 {
+	if max := int32(1)<<bitDepth - 1; uint32(n)&^uint32(max) != 0 {
+		return uint16((-n)>>31) & uint16(max)
+	}
+	return uint16(n)
+}
+
 func decodeBlock(dest []uint8, lineStride int, quantized [64]int16, mat [64]int32) {
 	var dequantized block
 	dequantized[0] = 4096 + ((int32(quantized[0]) * mat[0]) >> 2)
@@ -231,13 +297,264 @@ func decodeBlock(dest []uint8, lineStride int, quantized [64]int16, mat [64]int3
 	}
 }
 
-func (d *SliceDecoder) decodeChannel(data []byte, dest []uint8, offset func(int, int) int, stride int, rect image.Rectangle, scanOrder []int, scaledMatrix [64]int32, isSubsampled, isChroma bool) error {
+// Like decodeBlock, but outputs samples with the given bit depth, which must be 10 or 12. For 12-bit
+// output, the transform keeps two more bits of its fractional component.
+func decodeBlock16(dest []uint16, lineStride int, quantized [64]int16, mat [64]int32, bitDepth int) {
+	var dequantized block
+	dequantized[0] = 4096 + ((int32(quantized[0]) * mat[0]) >> 2)
+	for i := 1; i < 64; i++ {
+		dequantized[i] = (int32(quantized[i]) * mat[i]) >> 2
+	}
+	idctWithExtraBits(&dequantized, uint(bitDepth-10))
+	for row := 0; row < 8; row++ {
+		dequantized := dequantized[row<<3:]
+		dest := dest[row*lineStride:]
+		_ = dest[7]
+		_ = dequantized[7]
+		for i := 0; i < 8; i++ {
+			dest[i] = clampBits(dequantized[i], uint(bitDepth))
+		}
+	}
+}
+
+// A plane is one channel of a destination image. Blocks and rows are stored at positions given in
+// luma coordinates, even for chroma planes, and anything that falls outside of the plane is clipped.
+type plane struct {
+	// Exactly one of these is non-nil.
+	pix8  []uint8
+	pix16 []uint16
+
+	stride int
+
+	// The luma coordinates of the plane's first sample.
+	minX, minY int
+
+	// The size of the plane in samples.
+	width, height int
+
+	// 1 if the plane is horizontally subsampled.
+	xShift uint
+
+	// The number of significant bits in each element of pix16.
+	bitDepth int
+
+	precision IDCTPrecision
+
+	// The plane is scaled down by 2^scaleShift in both dimensions. Its rectangle is given in scaled
+	// luma coordinates, but positions passed to its methods are full-size luma coordinates.
+	scaleShift uint
+}
+
+func newPlane8(pix []uint8, stride int, rect image.Rectangle, xShift uint) plane {
+	return plane{
+		pix8:   pix,
+		stride: stride,
+		minX:   rect.Min.X,
+		minY:   rect.Min.Y,
+		width:  (rect.Max.X+1<<xShift-1)>>xShift - rect.Min.X>>xShift,
+		height: rect.Dy(),
+		xShift: xShift,
+	}
+}
+
+func newPlane16(pix []uint16, stride int, rect image.Rectangle, xShift uint, bitDepth int) plane {
+	ret := newPlane8(nil, stride, rect, xShift)
+	ret.pix16 = pix
+	ret.bitDepth = bitDepth
+	return ret
+}
+
+// Returns a view of the rows of the plane that belong to the top field if top is true or the bottom
+// field otherwise. The top field is made up of the even rows in luma coordinates.
+func (p plane) field(top bool) plane {
+	parity := 1
+	if top {
+		parity = 0
+	}
+	// The index of the plane's first row that belongs to the field.
+	row := (parity - p.minY) & 1
+	if p.pix8 != nil {
+		p.pix8 = p.pix8[row*p.stride:]
+	} else {
+		p.pix16 = p.pix16[row*p.stride:]
+	}
+	p.stride *= 2
+	p.minY = (p.minY + row - parity) / 2
+	p.height = (p.height + 1 - row) / 2
+	return p
+}
+
+// Clips a width by height area of samples at the given luma coordinates to the plane. The area's
+// size is given in samples of the full-size plane. Returns the offset of the area's first sample that
+// falls within the plane, that sample's position within the area, and the number of columns and rows
+// of the area that fall within the plane.
+func (p *plane) clip(x, y, width, height int) (offset, areaX, areaY, columns, rows int) {
+	if p.scaleShift > 0 {
+		x >>= p.scaleShift
+		y >>= p.scaleShift
+		width = (width + 1<<p.scaleShift - 1) >> p.scaleShift
+		height = (height + 1<<p.scaleShift - 1) >> p.scaleShift
+	}
+	px := x>>p.xShift - p.minX>>p.xShift
+	py := y - p.minY
+	if px < 0 {
+		areaX = -px
+	}
+	if py < 0 {
+		areaY = -py
+	}
+	columns = width - areaX
+	if px+width > p.width {
+		columns = p.width - px - areaX
+	}
+	rows = height - areaY
+	if py+height > p.height {
+		rows = p.height - py - areaY
+	}
+	if columns <= 0 || rows <= 0 {
+		return 0, 0, 0, 0, 0
+	}
+	return (py+areaY)*p.stride + px + areaX, areaX, areaY, columns, rows
+}
+
+// Returns whether any part of a width by height area at the given luma coordinates falls within the
+// plane.
+func (p *plane) intersects(x, y, width, height int) bool {
+	_, _, _, columns, _ := p.clip(x, y, width, height)
+	return columns > 0
+}
+
+// Dequantizes and transforms a block of coefficients, then stores the result at the given position.
+func (p *plane) putBlock(x, y int, coefficients *[64]int16, mat *[64]int32) {
+	offset, areaX, areaY, columns, rows := p.clip(x, y, BlockWidth, BlockHeight)
+	switch {
+	case columns == BlockWidth>>p.scaleShift && rows == BlockHeight>>p.scaleShift:
+		if p.pix8 != nil {
+			p.decodeBlock(p.pix8[offset:], p.stride, coefficients, mat)
+		} else {
+			p.decodeBlock16(p.pix16[offset:], p.stride, coefficients, mat)
+		}
+	case columns > 0 && rows > 0:
+		// The block straddles the edge of the plane, so only part of it can be stored.
+		if p.pix8 != nil {
+			var buf [BlockWidth * BlockHeight]uint8
+			p.decodeBlock(buf[:], BlockWidth, coefficients, mat)
+			for row := 0; row < rows; row++ {
+				copy(p.pix8[offset+row*p.stride:][:columns], buf[(areaY+row)*BlockWidth+areaX:])
+			}
+		} else {
+			var buf [BlockWidth * BlockHeight]uint16
+			p.decodeBlock16(buf[:], BlockWidth, coefficients, mat)
+			for row := 0; row < rows; row++ {
+				copy(p.pix16[offset+row*p.stride:][:columns], buf[(areaY+row)*BlockWidth+areaX:])
+			}
+		}
+	}
+}
+
+// Decodes a block into dest using the plane's scale and IDCT precision.
+func (p *plane) decodeBlock(dest []uint8, lineStride int, coefficients *[64]int16, mat *[64]int32) {
+	if p.scaleShift > 0 {
+		var samples [64]int32
+		reducedIDCT(&samples, coefficients, mat, p.scaleShift, 0)
+		n := BlockWidth >> p.scaleShift
+		for row := 0; row < n; row++ {
+			samples := samples[row*n : (row+1)*n]
+			dest := dest[row*lineStride:][:n]
+			for i, v := range samples {
+				dest[i] = uint8(clamp10bit(v) >> 2)
+			}
+		}
+		return
+	}
+	if p.precision != IDCTPrecisionInteger {
+		decodeBlock(dest, lineStride, *coefficients, *mat)
+		return
+	}
+	var samples [64]int16
+	integerIDCT(&samples, coefficients, mat, &integerIDCT10)
+	for row := 0; row < 8; row++ {
+		samples := samples[row<<3:]
+		dest := dest[row*lineStride:]
+		_ = dest[7]
+		_ = samples[7]
+		for i := 0; i < 8; i++ {
+			dest[i] = uint8(samples[i] >> 2)
+		}
+	}
+}
+
+// Like decodeBlock, but for planes with more than 8 bits per sample.
+func (p *plane) decodeBlock16(dest []uint16, lineStride int, coefficients *[64]int16, mat *[64]int32) {
+	if p.scaleShift > 0 {
+		var samples [64]int32
+		reducedIDCT(&samples, coefficients, mat, p.scaleShift, uint(p.bitDepth-10))
+		n := BlockWidth >> p.scaleShift
+		for row := 0; row < n; row++ {
+			samples := samples[row*n : (row+1)*n]
+			dest := dest[row*lineStride:][:n]
+			for i, v := range samples {
+				dest[i] = clampBits(v, uint(p.bitDepth))
+			}
+		}
+		return
+	}
+	if p.precision != IDCTPrecisionInteger {
+		decodeBlock16(dest, lineStride, *coefficients, *mat, p.bitDepth)
+		return
+	}
+	constants := &integerIDCT10
+	if p.bitDepth == 12 {
+		constants = &integerIDCT12
+	}
+	var samples [64]int16
+	integerIDCT(&samples, coefficients, mat, constants)
+	for row := 0; row < 8; row++ {
+		samples := samples[row<<3:]
+		dest := dest[row*lineStride:]
+		_ = dest[7]
+		_ = samples[7]
+		for i := 0; i < 8; i++ {
+			dest[i] = uint16(samples[i])
+		}
+	}
+}
+
+// Stores a row of 16-bit alpha values starting at the given position. If the plane is scaled down,
+// only the values that land on its samples are stored.
+func (p *plane) putAlphaRow(x, y int, values []uint16) {
+	step := 1 << p.scaleShift
+	if y&(step-1) != 0 {
+		return
+	}
+	offset, areaX, _, columns, rows := p.clip(x, y, len(values), 1)
+	if rows == 0 {
+		return
+	}
+	values = values[areaX*step:]
+	if p.pix8 != nil {
+		dest := p.pix8[offset:][:columns]
+		for i := range dest {
+			dest[i] = uint8(values[i*step] >> 8)
+		}
+	} else {
+		shift := uint(16 - p.bitDepth)
+		dest := p.pix16[offset:][:columns]
+		for i := range dest {
+			dest[i] = values[i*step] >> shift
+		}
+	}
+}
+
+// Decodes a channel's data from bs. If it can't be decoded, bs is left at the position where the error
+// was detected.
+func (d *SliceDecoder) decodeChannel(bs *Bitstream, dst *plane, mat *[64]int32, rect image.Rectangle, scanOrder []int, isSubsampled, isChroma bool) error {
 	blocksPerSlice := 4 * rect.Dx() / MacroblockWidth
 	if isSubsampled {
 		blocksPerSlice >>= 1
 	}
 	if blocksPerSlice > MaxBlocksPerSlice {
-		return fmt.Errorf("unsupported slice size")
+		return fmt.Errorf("%w: slice width of %v macroblocks", ErrUnsupported, rect.Dx()/MacroblockWidth)
 	}
 
 	coefficients := d.coefficientBuffers.Get().(*[MaxBlocksPerSlice][64]int16)
@@ -250,7 +567,12 @@ func (d *SliceDecoder) decodeChannel(data []byte, dest []uint8, offset func(int,
 		coeffsSlice[i] = [64]int16{}
 	}
 
-	if err := d.decodeCoefficients(coefficients, data, blocksPerSlice, scanOrder); err != nil {
+	if dst.scaleShift == 3 {
+		// Only the DC coefficients are needed.
+		if err := decodeDCCoefficients(bs, coefficients, blocksPerSlice); err != nil {
+			return fmt.Errorf("unable to decode dc coefficients: %w", err)
+		}
+	} else if err := d.decodeCoefficients(coefficients, bs, blocksPerSlice, scanOrder); err != nil {
 		return err
 	}
 
@@ -258,26 +580,123 @@ func (d *SliceDecoder) decodeChannel(data []byte, dest []uint8, offset func(int,
 		if isSubsampled {
 			for i := 0; i < rect.Dx()/MacroblockWidth; i++ {
 				coefficients := coefficients[i*2:]
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y):], stride, coefficients[0], scaledMatrix)
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight):], stride, coefficients[1], scaledMatrix)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y, &coefficients[0], mat)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight, &coefficients[1], mat)
 			}
 		} else {
 			for i := 0; i < rect.Dx()/MacroblockWidth; i++ {
 				coefficients := coefficients[i*4:]
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y):], stride, coefficients[0], scaledMatrix)
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight):], stride, coefficients[1], scaledMatrix)
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y):], stride, coefficients[2], scaledMatrix)
-				decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y+BlockHeight):], stride, coefficients[3], scaledMatrix)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y, &coefficients[0], mat)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight, &coefficients[1], mat)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y, &coefficients[2], mat)
+				dst.putBlock(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y+BlockHeight, &coefficients[3], mat)
 			}
 		}
 	} else {
 		for i := 0; i < rect.Dx()/MacroblockWidth; i++ {
 			coefficients := coefficients[i*4:]
-			decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y):], stride, coefficients[0], scaledMatrix)
-			decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y):], stride, coefficients[1], scaledMatrix)
-			decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight):], stride, coefficients[2], scaledMatrix)
-			decodeBlock(dest[offset(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y+BlockHeight):], stride, coefficients[3], scaledMatrix)
+			dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y, &coefficients[0], mat)
+			dst.putBlock(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y, &coefficients[1], mat)
+			dst.putBlock(rect.Min.X+i*MacroblockWidth, rect.Min.Y+BlockHeight, &coefficients[2], mat)
+			dst.putBlock(rect.Min.X+i*MacroblockWidth+BlockWidth, rect.Min.Y+BlockHeight, &coefficients[3], mat)
+		}
+	}
+	return nil
+}
+
+// Decodes run-length and difference coded alpha values into dest. The values are scaled to 16 bits
+// regardless of the coded bit depth.
+func decodeAlphaValues(bs *Bitstream, dest []uint16, bitDepth int) error {
+	mask := 1<<uint(bitDepth) - 1
+	diffBits := 4
+	if bitDepth == 16 {
+		diffBits = 7
+	}
+
+	scale := func(v int) uint16 {
+		if bitDepth == 8 {
+			return uint16(v<<8 | v)
+		}
+		return uint16(v)
+	}
+
+	alpha := mask
+	i := 0
+	for {
+		for {
+			var full bool
+			if !bs.ReadBit(&full) {
+				return fmt.Errorf("%w: unable to decode alpha value flag", ErrCorrupt)
+			}
+
+			var v int
+			if full {
+				if !bs.ReadInt(bitDepth, &v) {
+					return fmt.Errorf("%w: unable to decode alpha value", ErrCorrupt)
+				}
+			} else {
+				if !bs.ReadInt(diffBits, &v) {
+					return fmt.Errorf("%w: unable to decode alpha difference", ErrCorrupt)
+				}
+				sign := v & 1
+				v = (v + 2) >> 1
+				if sign != 0 {
+					v = -v
+				}
+			}
+			alpha = (alpha + v) & mask
+			dest[i] = scale(alpha)
+			i++
+
+			if i >= len(dest) {
+				return nil
+			}
+
+			var more bool
+			if !bs.ReadBit(&more) {
+				return fmt.Errorf("%w: unable to decode alpha continuation flag", ErrCorrupt)
+			} else if !more {
+				break
+			}
+		}
+
+		var run int
+		if !bs.ReadInt(4, &run) {
+			return fmt.Errorf("%w: unable to decode alpha run", ErrCorrupt)
+		} else if run == 0 && !bs.ReadInt(11, &run) {
+			return fmt.Errorf("%w: unable to decode alpha run", ErrCorrupt)
+		}
+		if i+run > len(dest) {
+			run = len(dest) - i
 		}
+		for v := scale(alpha); run > 0; run-- {
+			dest[i] = v
+			i++
+		}
+
+		if i >= len(dest) {
+			return nil
+		}
+	}
+}
+
+// Decodes alpha values from bs. If they can't be decoded, bs is left at the position where the error
+// was detected.
+func (d *SliceDecoder) decodeAlphaChannel(bs *Bitstream, dst *plane, rect image.Rectangle, bitDepth int) error {
+	if rect.Dx() > MaxMacroblocksPerSlice*MacroblockWidth {
+		return fmt.Errorf("%w: slice width of %v macroblocks", ErrUnsupported, rect.Dx()/MacroblockWidth)
+	}
+
+	values := d.alphaBuffers.Get().(*[MaxMacroblocksPerSlice * MacroblockWidth * MacroblockHeight]uint16)
+	defer d.alphaBuffers.Put(values)
+
+	width := rect.Dx()
+	if err := decodeAlphaValues(bs, values[:width*MacroblockHeight], bitDepth); err != nil {
+		return err
+	}
+
+	for row := 0; row < MacroblockHeight; row++ {
+		dst.putAlphaRow(rect.Min.X, rect.Min.Y+row, values[row*width:(row+1)*width])
 	}
 	return nil
 }
@@ -285,6 +704,8 @@ func (d *SliceDecoder) decodeChannel(data []byte, dest []uint8, offset func(int,
 // A SliceDecoder facilitates sharing of resources such as memory allocations between slices.
 type SliceDecoder struct {
 	coefficientBuffers sync.Pool
+	alphaBuffers       sync.Pool
+	dataBuffers        sync.Pool
 }
 
 func NewSliceDecoder() *SliceDecoder {
@@ -295,24 +716,177 @@ func NewSliceDecoder() *SliceDecoder {
 				return &ret
 			},
 		},
+		alphaBuffers: sync.Pool{
+			New: func() interface{} {
+				var ret [MaxMacroblocksPerSlice * MacroblockWidth * MacroblockHeight]uint16
+				return &ret
+			},
+		},
+		dataBuffers: sync.Pool{
+			New: func() interface{} {
+				// This is big enough for any slice in the index table.
+				ret := make([]byte, 0xffff)
+				return &ret
+			},
+		},
 	}
 }
 
-func (d *SliceDecoder) DecodeSlice(r *io.SectionReader, frameHeader *FrameHeader, img *image.YCbCr, rect image.Rectangle, scanOrder []int) error {
-	var header SliceHeader
-	if err := header.Decode(r); err != nil {
+// Returns size bytes of data starting at offset. If data isn't in memory, they're read into a buffer
+// from d.dataBuffers, which is also returned and should be put back once the bytes are no longer
+// needed.
+func (d *SliceDecoder) readData(data encodedData, offset, size int64) (*[]byte, []byte, error) {
+	if data.b != nil {
+		b, err := data.bytes(offset, size, nil)
+		return nil, b, err
+	}
+
+	buf := d.dataBuffers.Get().(*[]byte)
+	if int64(cap(*buf)) < size {
+		*buf = make([]byte, size)
+	}
+	b, err := data.bytes(offset, size, (*buf)[:cap(*buf)])
+	if err != nil {
+		d.dataBuffers.Put(buf)
+		return nil, nil, err
+	}
+	return buf, b, nil
+}
+
+// The planes that each of a slice's channels are stored in.
+type sliceWriters struct {
+	luma    plane
+	chromaU plane
+	chromaV plane
+	alpha   plane
+
+	// false if the destination has no alpha channel
+	hasAlpha bool
+}
+
+func newSliceWriters(dst image.Image) (sliceWriters, error) {
+	switch dst := dst.(type) {
+	case *image.YCbCr:
+		xShift, err := chromaShift(dst.SubsampleRatio)
+		if err != nil {
+			return sliceWriters{}, err
+		}
+		return sliceWriters{
+			luma:    newPlane8(dst.Y, dst.YStride, dst.Rect, 0),
+			chromaU: newPlane8(dst.Cb, dst.CStride, dst.Rect, xShift),
+			chromaV: newPlane8(dst.Cr, dst.CStride, dst.Rect, xShift),
+		}, nil
+	case *image.NYCbCrA:
+		ret, err := newSliceWriters(&dst.YCbCr)
+		if err != nil {
+			return sliceWriters{}, err
+		}
+		ret.alpha = newPlane8(dst.A, dst.AStride, dst.Rect, 0)
+		ret.hasAlpha = true
+		return ret, nil
+	case *YCbCr16:
+		if dst.BitDepth != 10 && dst.BitDepth != 12 {
+			return sliceWriters{}, fmt.Errorf("unsupported destination bit depth")
+		}
+		xShift, err := chromaShift(dst.SubsampleRatio)
+		if err != nil {
+			return sliceWriters{}, err
+		}
+		return sliceWriters{
+			luma:    newPlane16(dst.Y, dst.YStride, dst.Rect, 0, dst.BitDepth),
+			chromaU: newPlane16(dst.Cb, dst.CStride, dst.Rect, xShift, dst.BitDepth),
+			chromaV: newPlane16(dst.Cr, dst.CStride, dst.Rect, xShift, dst.BitDepth),
+		}, nil
+	case *NYCbCrA16:
+		ret, err := newSliceWriters(&dst.YCbCr16)
+		if err != nil {
+			return sliceWriters{}, err
+		}
+		ret.alpha = newPlane16(dst.A, dst.AStride, dst.Rect, 0, dst.BitDepth)
+		ret.hasAlpha = true
+		return ret, nil
+	}
+	return sliceWriters{}, fmt.Errorf("unsupported destination image type %T", dst)
+}
+
+// Returns the horizontal chroma subsampling shift for the given ratio. Only the ratios used by ProRes
+// are supported.
+func chromaShift(subsampleRatio image.YCbCrSubsampleRatio) (uint, error) {
+	switch subsampleRatio {
+	case image.YCbCrSubsampleRatio444:
+		return 0, nil
+	case image.YCbCrSubsampleRatio422:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported destination subsample ratio %v", subsampleRatio)
+}
+
+// Sets the IDCT precision of the color planes.
+func (w *sliceWriters) setPrecision(precision IDCTPrecision) {
+	w.luma.precision = precision
+	w.chromaU.precision = precision
+	w.chromaV.precision = precision
+}
+
+// Sets the scale of the planes, which must already have been created with scaled rectangles.
+func (w *sliceWriters) setScaleShift(shift uint) {
+	w.luma.scaleShift = shift
+	w.chromaU.scaleShift = shift
+	w.chromaV.scaleShift = shift
+	w.alpha.scaleShift = shift
+}
+
+// Returns writers for every other row of the destination, starting with the first row if top is
+// true or the second row otherwise.
+func (w sliceWriters) field(top bool) sliceWriters {
+	w.luma = w.luma.field(top)
+	w.chromaU = w.chromaU.field(top)
+	w.chromaV = w.chromaV.field(top)
+	if w.hasAlpha {
+		w.alpha = w.alpha.field(top)
+	}
+	return w
+}
+
+// Decodes a slice into dst, which must be an *image.YCbCr, *image.NYCbCrA, *YCbCr16, or *NYCbCrA16.
+// If the frame has an alpha channel and dst has one too, the alpha channel is decoded as well.
+func (d *SliceDecoder) DecodeSlice(r *io.SectionReader, frameHeader *FrameHeader, dst image.Image, rect image.Rectangle, scanOrder []int) error {
+	writers, err := newSliceWriters(dst)
+	if err != nil {
 		return err
 	}
 
-	pixelData := make([]byte, r.Size()-header.HeaderSize)
-	if n, err := r.ReadAt(pixelData, header.HeaderSize); n < len(pixelData) {
+	buf, data, err := d.readData(readerData(r, r.Size()), 0, r.Size())
+	if err != nil {
 		return err
 	}
+	defer d.dataBuffers.Put(buf)
 
-	qScale := int32(header.QuantizationIndex)
-	if header.QuantizationIndex >= 129 {
-		qScale = 128 + 4*int32(header.QuantizationIndex-128)
+	return d.decodeSlice(data, frameHeader, &writers, rect, scanOrder)
+}
+
+// Decodes a slice from data, which includes the slice header.
+func (d *SliceDecoder) decodeSlice(data []byte, frameHeader *FrameHeader, writers *sliceWriters, rect image.Rectangle, scanOrder []int) error {
+	var header SliceHeader
+	if err := header.decodeBytes(data); err != nil {
+		return err
 	}
+	pixelData := data[header.HeaderSize:]
+	declaredSize := header.LumaDataSize + header.ChromaUDataSize + header.ChromaVDataSize
+	if declaredSize > len(pixelData) {
+		return fmt.Errorf("%w: slice header declares %v bytes of data, but the slice only has %v", ErrInvalidHeader, declaredSize, len(pixelData))
+	}
+
+	quantizationIndex := header.QuantizationIndex
+	if writers.luma.precision == IDCTPrecisionInteger {
+		// Like FFmpeg, clamp the index to the range allowed by the spec.
+		if quantizationIndex < 1 {
+			quantizationIndex = 1
+		} else if quantizationIndex > 224 {
+			quantizationIndex = 224
+		}
+	}
+	qScale := int32(QuantizationScale(quantizationIndex))
 
 	var scaledLumaMatrix [64]int32
 	lumaMatrix := frameHeader.LumaQuantizationMatrix()
@@ -320,29 +894,57 @@ func (d *SliceDecoder) DecodeSlice(r *io.SectionReader, frameHeader *FrameHeader
 		scaledLumaMatrix[i] = int32(lumaMatrix[i]) * qScale
 	}
 
-	lumaData := pixelData[:header.LumaDataSize]
-	if err := d.decodeChannel(lumaData, img.Y, img.YOffset, img.YStride, rect, scanOrder, scaledLumaMatrix, false, false); err != nil {
-		return errors.Wrap(err, "unable to decode luma channel")
-	}
-	pixelData = pixelData[header.LumaDataSize:]
-
 	var scaledChromaMatrix [64]int32
 	chromaMatrix := frameHeader.ChromaQuantizationMatrix()
 	for i := 0; i < 64; i++ {
 		scaledChromaMatrix[i] = int32(chromaMatrix[i]) * qScale
 	}
 
+	// Returns a *SliceError for a channel that couldn't be decoded from bs, which holds the channel's
+	// data.
+	channelError := func(channel Channel, bs *Bitstream, err error) error {
+		return &SliceError{
+			X:         rect.Min.X / MacroblockWidth,
+			Y:         rect.Min.Y / MacroblockHeight,
+			Channel:   channel,
+			BitOffset: (len(data)-len(pixelData))*8 + bs.Offset,
+			Err:       err,
+		}
+	}
+
+	bs := Bitstream{Bytes: pixelData[:header.LumaDataSize]}
+	if err := d.decodeChannel(&bs, &writers.luma, &scaledLumaMatrix, rect, scanOrder, false, false); err != nil {
+		return channelError(ChannelLuma, &bs, err)
+	}
+	pixelData = pixelData[header.LumaDataSize:]
+
 	isChromaSubsampled := frameHeader.Flags.SubsampleRatio() == image.YCbCrSubsampleRatio422
 
-	chromaUData := pixelData[:header.ChromaUDataSize]
-	if err := d.decodeChannel(chromaUData, img.Cb, img.COffset, img.CStride, rect, scanOrder, scaledChromaMatrix, isChromaSubsampled, true); err != nil {
-		return errors.Wrap(err, "unable to decode chroma u channel")
+	bs = Bitstream{Bytes: pixelData[:header.ChromaUDataSize]}
+	if err := d.decodeChannel(&bs, &writers.chromaU, &scaledChromaMatrix, rect, scanOrder, isChromaSubsampled, true); err != nil {
+		return channelError(ChannelChromaU, &bs, err)
 	}
 	pixelData = pixelData[header.ChromaUDataSize:]
 
 	chromaVData := pixelData
-	if err := d.decodeChannel(chromaVData, img.Cr, img.COffset, img.CStride, rect, scanOrder, scaledChromaMatrix, isChromaSubsampled, true); err != nil {
-		return errors.Wrap(err, "unable to decode chroma v channel")
+	if header.HasChromaVDataSize() {
+		chromaVData = pixelData[:header.ChromaVDataSize]
+	}
+	bs = Bitstream{Bytes: chromaVData}
+	if err := d.decodeChannel(&bs, &writers.chromaV, &scaledChromaMatrix, rect, scanOrder, isChromaSubsampled, true); err != nil {
+		return channelError(ChannelChromaV, &bs, err)
+	}
+	pixelData = pixelData[len(chromaVData):]
+
+	if writers.hasAlpha && frameHeader.AlphaInfo.HasAlpha() {
+		bitDepth := frameHeader.AlphaInfo.BitDepth()
+		if bitDepth == 0 {
+			return fmt.Errorf("%w: alpha info %v", ErrUnsupported, frameHeader.AlphaInfo)
+		}
+		bs = Bitstream{Bytes: pixelData}
+		if err := d.decodeAlphaChannel(&bs, &writers.alpha, rect, bitDepth); err != nil {
+			return channelError(ChannelAlpha, &bs, err)
+		}
 	}
 
 	return nil
@@ -0,0 +1,359 @@
+package prores
+
+import (
+	"fmt"
+	"image"
+)
+
+func encodeDCCoefficients(w *BitstreamWriter, coeffs *[MaxBlocksPerSlice][64]int16, numberOfBlocks int) {
+	prev := int(coeffs[0][0])
+	if prev < 0 {
+		CodeParameters(0xb8).Encode(w, -2*prev-1)
+	} else {
+		CodeParameters(0xb8).Encode(w, 2*prev)
+	}
+
+	code := 5
+	sign := 0
+	for i := 1; i < numberOfBlocks; i++ {
+		params := dcCodeParams[len(dcCodeParams)-1]
+		if code < len(dcCodeParams) {
+			params = dcCodeParams[code]
+		}
+
+		delta := int(coeffs[i][0]) - prev
+		prev = int(coeffs[i][0])
+
+		// Odd codes flip the sign of the delta relative to the previous one. Zero resets it.
+		switch {
+		case delta == 0:
+			code = 0
+			sign = 0
+		case delta < 0 && sign == 0:
+			code = -2*delta - 1
+			sign = -1
+		case delta < 0:
+			code = -2 * delta
+		case sign != 0:
+			code = 2*delta - 1
+			sign = 0
+		default:
+			code = 2 * delta
+		}
+		params.Encode(w, code)
+	}
+}
+
+func encodeACCoefficients(w *BitstreamWriter, coeffs *[MaxBlocksPerSlice][64]int16, numberOfBlocks int, scanOrder []int) {
+	run := 4
+	level := 2
+
+	lastPos := numberOfBlocks - 1
+	for scanIndex := 1; scanIndex < 64; scanIndex++ {
+		i := scanOrder[scanIndex]
+		for block := 0; block < numberOfBlocks; block++ {
+			v := int(coeffs[block][i])
+			if v == 0 {
+				continue
+			}
+			pos := scanIndex*numberOfBlocks + block
+
+			params := acRunCodeParams[len(acRunCodeParams)-1]
+			if run < len(acRunCodeParams) {
+				params = acRunCodeParams[run]
+			}
+			run = pos - lastPos - 1
+			params.Encode(w, run)
+
+			params = acLevelCodeParams[len(acLevelCodeParams)-1]
+			if level < len(acLevelCodeParams) {
+				params = acLevelCodeParams[level]
+			}
+			level = v
+			if v < 0 {
+				level = -v
+			}
+			params.Encode(w, level-1)
+
+			w.WriteBit(v < 0)
+			lastPos = pos
+		}
+	}
+}
+
+// Encodes alpha values such that decodeAlphaValues reads them back. The values are given with 16
+// bits, but only the high bitDepth bits are encoded.
+func encodeAlphaValues(w *BitstreamWriter, values []uint16, bitDepth int) {
+	mask := 1<<uint(bitDepth) - 1
+	diffBits := 4
+	if bitDepth == 16 {
+		diffBits = 7
+	}
+	maxDiff := 1 << uint(diffBits-1)
+
+	alpha := mask
+	for i := 0; i < len(values); {
+		v := int(values[i] >> uint(16-bitDepth))
+		diff := (v - alpha) & mask
+		if diff > mask/2 {
+			diff -= mask + 1
+		}
+		if diff != 0 && diff >= -maxDiff && diff <= maxDiff {
+			w.WriteBit(false)
+			if diff < 0 {
+				w.WriteInt(diffBits, (-diff-1)<<1|1)
+			} else {
+				w.WriteInt(diffBits, (diff-1)<<1)
+			}
+		} else {
+			w.WriteBit(true)
+			w.WriteInt(bitDepth, diff)
+		}
+		alpha = v
+		i++
+
+		if i >= len(values) {
+			break
+		}
+
+		run := 0
+		for i+run < len(values) && int(values[i+run]>>uint(16-bitDepth)) == alpha && run < 0x7ff {
+			run++
+		}
+		if run == 0 {
+			w.WriteBit(true)
+			continue
+		}
+		w.WriteBit(false)
+		if run < 0x10 {
+			w.WriteInt(4, run)
+		} else {
+			w.WriteInt(4, 0)
+			w.WriteInt(11, run)
+		}
+		i += run
+	}
+}
+
+// Returns the quantization scale for a slice's quantization index. The scale is linear up to 128,
+// then grows by 4 per index.
+func QuantizationScale(quantizationIndex int) int {
+	if quantizationIndex >= 129 {
+		return 128 + 4*(quantizationIndex-128)
+	}
+	return quantizationIndex
+}
+
+// Quantizes coefficients produced by FDCT from samples with the given bit depth (10 or 12). matrix
+// is the 64-entry luma or chroma quantization matrix, as returned by FrameHeader's
+// LumaQuantizationMatrix or ChromaQuantizationMatrix, and quantizationIndex is the slice's
+// quantization index. The results are what DecodeSlice expects to find in the bitstream.
+//
+// An error is returned if the quantization index isn't between 1 and 224, any matrix entry isn't
+// between 1 and 127, or the bit depth isn't 10 or 12. These are the ranges a ProRes bitstream can
+// express, and dest is left untouched.
+func Quantize(dest *[64]int16, coefficients *[64]int32, matrix []int8, quantizationIndex, bitDepth int) error {
+	if quantizationIndex < 1 || quantizationIndex > 224 {
+		return fmt.Errorf("quantization index %v is not between 1 and 224", quantizationIndex)
+	}
+	if len(matrix) != 64 {
+		return fmt.Errorf("quantization matrix has %v entries instead of 64", len(matrix))
+	}
+	for i, v := range matrix {
+		if v < 1 {
+			return fmt.Errorf("quantization matrix entry %v is %v, which is not between 1 and 127", i, v)
+		}
+	}
+	if bitDepth != 10 && bitDepth != 12 {
+		return fmt.Errorf("unsupported bit depth %v", bitDepth)
+	}
+	qScale := int32(QuantizationScale(quantizationIndex))
+	var scaledMatrix [64]int32
+	for i := 0; i < 64; i++ {
+		scaledMatrix[i] = int32(matrix[i]) * qScale
+	}
+	quantizeBlock(dest, (*block)(coefficients), &scaledMatrix, bitDepth)
+	return nil
+}
+
+// Quantizes coefficients produced by fdct from samples with the given bit depth. The results are
+// what decodeBlock expects.
+func quantizeBlock(dest *[64]int16, coeffs *block, mat *[64]int32, bitDepth int) {
+	// fdct's output is scaled up by 8 and decodeBlock shifts the dequantized coefficients down by 2,
+	// so we need to divide by 2 on top of the matrix. Samples with more than 10 bits need to be
+	// scaled down further.
+	shift := uint(1 + bitDepth - 10)
+	for i, c := range coeffs {
+		d := mat[i] << shift
+		var q int32
+		if c < 0 {
+			q = -((-c + d/2) / d)
+		} else {
+			q = (c + d/2) / d
+		}
+		if q > 0x7fff {
+			q = 0x7fff
+		} else if q < -0x7fff {
+			q = -0x7fff
+		}
+		dest[i] = int16(q)
+	}
+}
+
+// A sliceEncoder facilitates sharing of resources between slices.
+type sliceEncoder struct {
+	coefficients [3][MaxBlocksPerSlice]block
+	quantized    [MaxBlocksPerSlice][64]int16
+	writers      [3]BitstreamWriter
+	alphaWriter  BitstreamWriter
+}
+
+// The parameters shared by all slices of a picture.
+type sliceEncoderConfig struct {
+	img          *YCbCr16
+	lumaMatrix   [64]int32
+	chromaMatrix [64]int32
+	minQuant     int
+	scanOrder    []int
+
+	// 16-bit alpha samples with the same dimensions and stride as img's luma plane, or nil if the
+	// alpha channel isn't encoded.
+	alpha         []uint16
+	alphaBitDepth int
+}
+
+// Reads a block of samples from the given plane and transforms it. x and y are in plane coordinates.
+func (e *sliceEncoder) transformBlock(dest *block, plane []uint16, stride, x, y, bitDepth int) {
+	bias := int32(1) << uint(bitDepth-1)
+	for row := 0; row < BlockHeight; row++ {
+		src := plane[(y+row)*stride+x:]
+		_ = src[7]
+		for col := 0; col < BlockWidth; col++ {
+			dest[row*BlockWidth+col] = int32(src[col]) - bias
+		}
+	}
+	fdct(dest)
+}
+
+// Transforms the blocks of each channel in the order that decodeChannel expects them.
+func (e *sliceEncoder) transform(img *YCbCr16, rect image.Rectangle) (lumaBlocks, chromaBlocks int) {
+	isSubsampled := img.SubsampleRatio == image.YCbCrSubsampleRatio422
+	mbs := rect.Dx() / MacroblockWidth
+
+	luma := e.coefficients[0][:]
+	for i := 0; i < mbs; i++ {
+		x := rect.Min.X + i*MacroblockWidth
+		e.transformBlock(&luma[i*4+0], img.Y, img.YStride, x, rect.Min.Y, img.BitDepth)
+		e.transformBlock(&luma[i*4+1], img.Y, img.YStride, x+BlockWidth, rect.Min.Y, img.BitDepth)
+		e.transformBlock(&luma[i*4+2], img.Y, img.YStride, x, rect.Min.Y+BlockHeight, img.BitDepth)
+		e.transformBlock(&luma[i*4+3], img.Y, img.YStride, x+BlockWidth, rect.Min.Y+BlockHeight, img.BitDepth)
+	}
+
+	for c, plane := range [][]uint16{img.Cb, img.Cr} {
+		chroma := e.coefficients[1+c][:]
+		for i := 0; i < mbs; i++ {
+			if isSubsampled {
+				x := (rect.Min.X + i*MacroblockWidth) / 2
+				e.transformBlock(&chroma[i*2+0], plane, img.CStride, x, rect.Min.Y, img.BitDepth)
+				e.transformBlock(&chroma[i*2+1], plane, img.CStride, x, rect.Min.Y+BlockHeight, img.BitDepth)
+			} else {
+				x := rect.Min.X + i*MacroblockWidth
+				e.transformBlock(&chroma[i*4+0], plane, img.CStride, x, rect.Min.Y, img.BitDepth)
+				e.transformBlock(&chroma[i*4+1], plane, img.CStride, x, rect.Min.Y+BlockHeight, img.BitDepth)
+				e.transformBlock(&chroma[i*4+2], plane, img.CStride, x+BlockWidth, rect.Min.Y, img.BitDepth)
+				e.transformBlock(&chroma[i*4+3], plane, img.CStride, x+BlockWidth, rect.Min.Y+BlockHeight, img.BitDepth)
+			}
+		}
+	}
+
+	if isSubsampled {
+		return mbs * 4, mbs * 2
+	}
+	return mbs * 4, mbs * 4
+}
+
+// Quantizes and entropy codes the transformed channels with the given quantization index. Returns
+// the total number of bits written.
+func (e *sliceEncoder) code(config *sliceEncoderConfig, lumaBlocks, chromaBlocks, quantizationIndex int) int {
+	qScale := int32(QuantizationScale(quantizationIndex))
+
+	var scaledLumaMatrix, scaledChromaMatrix [64]int32
+	for i := 0; i < 64; i++ {
+		scaledLumaMatrix[i] = config.lumaMatrix[i] * qScale
+		scaledChromaMatrix[i] = config.chromaMatrix[i] * qScale
+	}
+
+	total := 0
+	for c := range e.writers {
+		w := &e.writers[c]
+		w.Reset()
+
+		numberOfBlocks, mat := lumaBlocks, &scaledLumaMatrix
+		if c > 0 {
+			numberOfBlocks, mat = chromaBlocks, &scaledChromaMatrix
+		}
+		for i := 0; i < numberOfBlocks; i++ {
+			quantizeBlock(&e.quantized[i], &e.coefficients[c][i], mat, config.img.BitDepth)
+		}
+		encodeDCCoefficients(w, &e.quantized, numberOfBlocks)
+		encodeACCoefficients(w, &e.quantized, numberOfBlocks, config.scanOrder)
+		w.Bytes()
+		total += w.Len()
+	}
+	return total
+}
+
+const maxQuantizationIndex = 224
+
+// Encodes the slice covering rect, using the lowest quantization index that keeps the slice within
+// the given number of bits.
+func (e *sliceEncoder) encodeSlice(config *sliceEncoderConfig, rect image.Rectangle, targetBits int) ([]byte, error) {
+	lumaBlocks, chromaBlocks := e.transform(config.img, rect)
+
+	headerSize := 6
+	var alpha []byte
+	if config.alpha != nil {
+		headerSize = 8
+
+		// The alpha values are coded in raster order.
+		values := make([]uint16, 0, rect.Dx()*MacroblockHeight)
+		stride := config.img.YStride
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			values = append(values, config.alpha[y*stride+rect.Min.X:y*stride+rect.Max.X]...)
+		}
+		e.alphaWriter.Reset()
+		encodeAlphaValues(&e.alphaWriter, values, config.alphaBitDepth)
+		alpha = e.alphaWriter.Bytes()
+	}
+
+	// The number of bits is roughly monotonic in the quantization index, so a binary search gets us
+	// close enough.
+	lo, hi := config.minQuant, maxQuantizationIndex
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if headerSize*8+e.code(config, lumaBlocks, chromaBlocks, mid) <= targetBits {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	e.code(config, lumaBlocks, chromaBlocks, lo)
+
+	luma := e.writers[0].bytes
+	chromaU := e.writers[1].bytes
+	chromaV := e.writers[2].bytes
+	if len(luma) > 0xffff || len(chromaU) > 0xffff || headerSize+len(luma)+len(chromaU)+len(chromaV)+len(alpha) > 0xffff {
+		return nil, fmt.Errorf("slice is too large")
+	}
+
+	ret := make([]byte, 0, headerSize+len(luma)+len(chromaU)+len(chromaV)+len(alpha))
+	ret = append(ret, byte(headerSize<<3), byte(lo), byte(len(luma)>>8), byte(len(luma)), byte(len(chromaU)>>8), byte(len(chromaU)))
+	if alpha != nil {
+		ret = append(ret, byte(len(chromaV)>>8), byte(len(chromaV)))
+	}
+	ret = append(ret, luma...)
+	ret = append(ret, chromaU...)
+	ret = append(ret, chromaV...)
+	ret = append(ret, alpha...)
+	return ret, nil
+}
@@ -1,9 +1,13 @@
 package prores
 
 import (
+	"bytes"
+	"errors"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClamp10Bit(t *testing.T) {
@@ -21,6 +25,43 @@ func TestCodeParameters_Decode(t *testing.T) {
 	assert.Equal(t, code, 649)
 }
 
+func TestCodeParameters_Encode(t *testing.T) {
+	var w BitstreamWriter
+	rng := rand.New(rand.NewSource(1))
+	values := make([]int, 2000)
+	for i := range values {
+		// Mostly small values, which exercise the golomb-rice branch, with some large ones for the
+		// exponential-golomb branch.
+		switch i % 4 {
+		case 0:
+			values[i] = rng.Intn(1 << 20)
+		case 1:
+			values[i] = rng.Intn(256)
+		default:
+			values[i] = rng.Intn(16)
+		}
+	}
+
+	for i := 0; i < 256; i++ {
+		p := CodeParameters(i)
+
+		w.Reset()
+		offsets := make([]int, len(values))
+		for j, v := range values {
+			p.Encode(&w, v)
+			offsets[j] = w.Len()
+		}
+
+		bs := &Bitstream{Bytes: w.Bytes()}
+		for j, v := range values {
+			var decoded int
+			require.True(t, p.Decode(bs, &decoded), "code parameters: %#x, value: %v", i, v)
+			require.Equal(t, v, decoded, "code parameters: %#x", i)
+			require.Equal(t, offsets[j], bs.Offset, "code parameters: %#x, value: %v", i, v)
+		}
+	}
+}
+
 func TestDecodeCoefficients(t *testing.T) {
 	b := []byte{
 		0x17, 0x7a, 0x2, 0xf2, 0x80, 0xb7, 0xb0, 0x2e, 0x12, 0xc, 0x3b, 0x3, 0x3, 0x0, 0xc1, 0xe0,
@@ -40,7 +81,7 @@ func TestDecodeCoefficients(t *testing.T) {
 	}
 
 	var coeffs [MaxBlocksPerSlice][64]int16
-	assert.NoError(t, NewSliceDecoder().decodeCoefficients(&coeffs, b, 32, ProgressiveScanOrder))
+	assert.NoError(t, NewSliceDecoder().decodeCoefficients(&coeffs, &Bitstream{Bytes: b}, 32, ProgressiveScanOrder))
 
 	var expected [MaxBlocksPerSlice][64]int16
 	for i, n := range []int16{
@@ -184,3 +225,90 @@ func TestDecodeCoefficients(t *testing.T) {
 
 	assert.Equal(t, expected, coeffs)
 }
+
+// Converts a string of '0' and '1' characters into bytes, ignoring all other characters and padding
+// the final byte with zeros.
+func bitStringBytes(s string) []byte {
+	var ret []byte
+	n := 0
+	for _, c := range s {
+		if c != '0' && c != '1' {
+			continue
+		}
+		if n%8 == 0 {
+			ret = append(ret, 0)
+		}
+		if c == '1' {
+			ret[n/8] |= 0x80 >> uint(n%8)
+		}
+		n++
+	}
+	return ret
+}
+
+func TestDecodeCoefficients_InvalidPosition(t *testing.T) {
+	// A single block whose first AC coefficient is 101 positions in, past the end of the block.
+	var w BitstreamWriter
+	CodeParameters(0xb8).Encode(&w, 0)
+	acRunCodeParams[4].Encode(&w, 100)
+	acLevelCodeParams[2].Encode(&w, 0)
+	w.WriteBit(false)
+
+	var coeffs [MaxBlocksPerSlice][64]int16
+	err := NewSliceDecoder().decodeCoefficients(&coeffs, &Bitstream{Bytes: w.Bytes()}, 1, ProgressiveScanOrder)
+	assert.True(t, errors.Is(err, ErrCorrupt), "%v", err)
+}
+
+func TestSliceHeader_Decode(t *testing.T) {
+	t.Run("WithoutAlpha", func(t *testing.T) {
+		var header SliceHeader
+		assert.NoError(t, header.Decode(bytes.NewReader([]byte{0x30, 0x05, 0x01, 0x00, 0x00, 0x80})))
+		assert.Equal(t, SliceHeader{
+			HeaderSize:        6,
+			QuantizationIndex: 5,
+			LumaDataSize:      256,
+			ChromaUDataSize:   128,
+		}, header)
+		assert.False(t, header.HasChromaVDataSize())
+	})
+
+	t.Run("WithAlpha", func(t *testing.T) {
+		var header SliceHeader
+		assert.NoError(t, header.Decode(bytes.NewReader([]byte{0x40, 0x05, 0x01, 0x00, 0x00, 0x80, 0x00, 0x70})))
+		assert.Equal(t, SliceHeader{
+			HeaderSize:        8,
+			QuantizationIndex: 5,
+			LumaDataSize:      256,
+			ChromaUDataSize:   128,
+			ChromaVDataSize:   112,
+		}, header)
+		assert.True(t, header.HasChromaVDataSize())
+	})
+}
+
+func TestDecodeAlphaValues(t *testing.T) {
+	t.Run("8Bit", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes: bitStringBytes("0 0011 1 1 10000011 0 0011 1 00000000 0 0000 00000010100"),
+		}
+		dest := make([]uint16, 8)
+		assert.NoError(t, decodeAlphaValues(bs, dest, 8))
+		assert.Equal(t, []uint16{253 * 257, 128 * 257, 128 * 257, 128 * 257, 128 * 257, 128 * 257, 128 * 257, 128 * 257}, dest)
+	})
+
+	t.Run("16Bit", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes: bitStringBytes("0 0000001 1 1 0000000000000010"),
+		}
+		dest := make([]uint16, 2)
+		assert.NoError(t, decodeAlphaValues(bs, dest, 16))
+		assert.Equal(t, []uint16{65534, 0}, dest)
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		bs := &Bitstream{
+			Bytes: bitStringBytes("0 0011 1"),
+		}
+		assert.Error(t, decodeAlphaValues(bs, make([]uint16, 8), 8))
+	})
+}
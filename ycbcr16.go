@@ -0,0 +1,322 @@
+package prores
+
+import (
+	"image"
+	"image/color"
+)
+
+// YCbCr16Color represents a Y'CbCr color with 16 bits per channel. It uses the same conversion
+// formulas as color.YCbCr.
+type YCbCr16Color struct {
+	Y, Cb, Cr uint16
+}
+
+func (c YCbCr16Color) RGBA() (uint32, uint32, uint32, uint32) {
+	// These are the color.YCbCr coefficients, scaled by 1<<16.
+	yy := int64(c.Y) << 16
+	cb := int64(c.Cb) - 0x8000
+	cr := int64(c.Cr) - 0x8000
+
+	r := (yy + 91881*cr) >> 16
+	g := (yy - 22554*cb - 46802*cr) >> 16
+	b := (yy + 116130*cb) >> 16
+	return clamp16bit(r), clamp16bit(g), clamp16bit(b), 0xffff
+}
+
+// NYCbCrA16Color represents a non-alpha-premultiplied Y'CbCr-with-alpha color with 16 bits per
+// channel.
+type NYCbCrA16Color struct {
+	YCbCr16Color
+	A uint16
+}
+
+func (c NYCbCrA16Color) RGBA() (uint32, uint32, uint32, uint32) {
+	r, g, b, _ := c.YCbCr16Color.RGBA()
+	a := uint32(c.A)
+	return r * a / 0xffff, g * a / 0xffff, b * a / 0xffff, a
+}
+
+func clamp16bit(n int64) uint32 {
+	if n < 0 {
+		return 0
+	} else if n > 0xffff {
+		return 0xffff
+	}
+	return uint32(n)
+}
+
+var (
+	YCbCr16Model   = color.ModelFunc(yCbCr16Model)
+	NYCbCrA16Model = color.ModelFunc(nYCbCrA16Model)
+)
+
+func rgbToYCbCr16(r, g, b uint32) YCbCr16Color {
+	// These are the color.RGBToYCbCr coefficients, scaled by 1<<16.
+	rr, gg, bb := int64(r), int64(g), int64(b)
+	y := (19595*rr + 38470*gg + 7471*bb + 1<<15) >> 16
+	cb := (-11056*rr - 21712*gg + 32768*bb + 1<<15 + 0x8000<<16) >> 16
+	cr := (32768*rr - 27440*gg - 5328*bb + 1<<15 + 0x8000<<16) >> 16
+	return YCbCr16Color{uint16(clamp16bit(y)), uint16(clamp16bit(cb)), uint16(clamp16bit(cr))}
+}
+
+func yCbCr16Model(c color.Color) color.Color {
+	switch c := c.(type) {
+	case YCbCr16Color:
+		return c
+	case NYCbCrA16Color:
+		return c.YCbCr16Color
+	}
+	r, g, b, _ := c.RGBA()
+	return rgbToYCbCr16(r, g, b)
+}
+
+func nYCbCrA16Model(c color.Color) color.Color {
+	switch c := c.(type) {
+	case NYCbCrA16Color:
+		return c
+	case YCbCr16Color:
+		return NYCbCrA16Color{c, 0xffff}
+	}
+	r, g, b, a := c.RGBA()
+	if a != 0 {
+		r = r * 0xffff / a
+		g = g * 0xffff / a
+		b = b * 0xffff / a
+	}
+	return NYCbCrA16Color{rgbToYCbCr16(r, g, b), uint16(a)}
+}
+
+// YCbCr16 is laid out exactly like image.YCbCr, but each sample is a uint16 with BitDepth significant
+// bits. This allows 10-bit and 12-bit samples to be decoded without any loss of precision.
+type YCbCr16 struct {
+	Y, Cb, Cr      []uint16
+	YStride        int
+	CStride        int
+	SubsampleRatio image.YCbCrSubsampleRatio
+	BitDepth       int
+	Rect           image.Rectangle
+}
+
+// Scales a sample with the given bit depth up to 16 bits.
+func scaleTo16bit(v uint16, bitDepth int) uint16 {
+	return uint16(uint32(v) * 0xffff / (1<<uint(bitDepth) - 1))
+}
+
+func (p *YCbCr16) ColorModel() color.Model {
+	return YCbCr16Model
+}
+
+func (p *YCbCr16) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+func (p *YCbCr16) At(x, y int) color.Color {
+	return p.YCbCr16At(x, y)
+}
+
+func (p *YCbCr16) YCbCr16At(x, y int) YCbCr16Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return YCbCr16Color{}
+	}
+	yi := p.YOffset(x, y)
+	ci := p.COffset(x, y)
+	return YCbCr16Color{
+		Y:  scaleTo16bit(p.Y[yi], p.BitDepth),
+		Cb: scaleTo16bit(p.Cb[ci], p.BitDepth),
+		Cr: scaleTo16bit(p.Cr[ci], p.BitDepth),
+	}
+}
+
+// YOffset returns the index of the first element of Y that corresponds to the pixel at (x, y).
+func (p *YCbCr16) YOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.YStride + (x - p.Rect.Min.X)
+}
+
+// COffset returns the index of the first element of Cb or Cr that corresponds to the pixel at (x, y).
+func (p *YCbCr16) COffset(x, y int) int {
+	switch p.SubsampleRatio {
+	case image.YCbCrSubsampleRatio422:
+		return (y-p.Rect.Min.Y)*p.CStride + (x/2 - p.Rect.Min.X/2)
+	case image.YCbCrSubsampleRatio420:
+		return (y/2-p.Rect.Min.Y/2)*p.CStride + (x/2 - p.Rect.Min.X/2)
+	case image.YCbCrSubsampleRatio440:
+		return (y/2-p.Rect.Min.Y/2)*p.CStride + (x - p.Rect.Min.X)
+	case image.YCbCrSubsampleRatio411:
+		return (y-p.Rect.Min.Y)*p.CStride + (x/4 - p.Rect.Min.X/4)
+	case image.YCbCrSubsampleRatio410:
+		return (y/2-p.Rect.Min.Y/2)*p.CStride + (x/4 - p.Rect.Min.X/4)
+	}
+	// Default to 4:4:4 subsampling.
+	return (y-p.Rect.Min.Y)*p.CStride + (x - p.Rect.Min.X)
+}
+
+// SubImage returns an image representing the portion of the image p visible through r. The returned
+// value shares pixels with the original image.
+func (p *YCbCr16) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside either r1 or r2
+	// if the intersection is empty. Without explicitly checking for this, the Pix[i:] expression
+	// below can panic.
+	if r.Empty() {
+		return &YCbCr16{
+			SubsampleRatio: p.SubsampleRatio,
+			BitDepth:       p.BitDepth,
+		}
+	}
+	yi := p.YOffset(r.Min.X, r.Min.Y)
+	ci := p.COffset(r.Min.X, r.Min.Y)
+	return &YCbCr16{
+		Y:              p.Y[yi:],
+		Cb:             p.Cb[ci:],
+		Cr:             p.Cr[ci:],
+		SubsampleRatio: p.SubsampleRatio,
+		YStride:        p.YStride,
+		CStride:        p.CStride,
+		BitDepth:       p.BitDepth,
+		Rect:           r,
+	}
+}
+
+func (p *YCbCr16) Opaque() bool {
+	return true
+}
+
+func yCbCrSize(r image.Rectangle, subsampleRatio image.YCbCrSubsampleRatio) (w, h, cw, ch int) {
+	w, h = r.Dx(), r.Dy()
+	switch subsampleRatio {
+	case image.YCbCrSubsampleRatio422:
+		cw = (r.Max.X+1)/2 - r.Min.X/2
+		ch = h
+	case image.YCbCrSubsampleRatio420:
+		cw = (r.Max.X+1)/2 - r.Min.X/2
+		ch = (r.Max.Y+1)/2 - r.Min.Y/2
+	case image.YCbCrSubsampleRatio440:
+		cw = w
+		ch = (r.Max.Y+1)/2 - r.Min.Y/2
+	case image.YCbCrSubsampleRatio411:
+		cw = (r.Max.X+3)/4 - r.Min.X/4
+		ch = h
+	case image.YCbCrSubsampleRatio410:
+		cw = (r.Max.X+3)/4 - r.Min.X/4
+		ch = (r.Max.Y+1)/2 - r.Min.Y/2
+	default:
+		// Default to 4:4:4 subsampling.
+		cw = w
+		ch = h
+	}
+	return
+}
+
+// NewYCbCr16 returns a new YCbCr16 image with the given bounds, subsample ratio, and bit depth.
+func NewYCbCr16(r image.Rectangle, subsampleRatio image.YCbCrSubsampleRatio, bitDepth int) *YCbCr16 {
+	w, h, cw, ch := yCbCrSize(r, subsampleRatio)
+
+	i0 := w*h + 0*cw*ch
+	i1 := w*h + 1*cw*ch
+	i2 := w*h + 2*cw*ch
+	b := make([]uint16, i2)
+	return &YCbCr16{
+		Y:              b[:i0:i0],
+		Cb:             b[i0:i1:i1],
+		Cr:             b[i1:i2:i2],
+		SubsampleRatio: subsampleRatio,
+		YStride:        w,
+		CStride:        cw,
+		BitDepth:       bitDepth,
+		Rect:           r,
+	}
+}
+
+// NYCbCrA16 is a YCbCr16 image with a non-alpha-premultiplied alpha channel. The alpha samples have
+// the same bit depth as the color samples.
+type NYCbCrA16 struct {
+	YCbCr16
+	A       []uint16
+	AStride int
+}
+
+func (p *NYCbCrA16) ColorModel() color.Model {
+	return NYCbCrA16Model
+}
+
+func (p *NYCbCrA16) At(x, y int) color.Color {
+	return p.NYCbCrA16At(x, y)
+}
+
+func (p *NYCbCrA16) NYCbCrA16At(x, y int) NYCbCrA16Color {
+	if !(image.Point{X: x, Y: y}.In(p.Rect)) {
+		return NYCbCrA16Color{}
+	}
+	return NYCbCrA16Color{
+		YCbCr16Color: p.YCbCr16At(x, y),
+		A:            scaleTo16bit(p.A[p.AOffset(x, y)], p.BitDepth),
+	}
+}
+
+// AOffset returns the index of the first element of A that corresponds to the pixel at (x, y).
+func (p *NYCbCrA16) AOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.AStride + (x - p.Rect.Min.X)
+}
+
+// SubImage returns an image representing the portion of the image p visible through r. The returned
+// value shares pixels with the original image.
+func (p *NYCbCrA16) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &NYCbCrA16{
+			YCbCr16: YCbCr16{
+				SubsampleRatio: p.SubsampleRatio,
+				BitDepth:       p.BitDepth,
+			},
+		}
+	}
+	ai := p.AOffset(r.Min.X, r.Min.Y)
+	return &NYCbCrA16{
+		YCbCr16: *p.YCbCr16.SubImage(r).(*YCbCr16),
+		A:       p.A[ai:],
+		AStride: p.AStride,
+	}
+}
+
+func (p *NYCbCrA16) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+	max := uint16(1<<uint(p.BitDepth) - 1)
+	i0, i1 := 0, p.Rect.Dx()
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for _, a := range p.A[i0:i1] {
+			if a != max {
+				return false
+			}
+		}
+		i0 += p.AStride
+		i1 += p.AStride
+	}
+	return true
+}
+
+// NewNYCbCrA16 returns a new NYCbCrA16 image with the given bounds, subsample ratio, and bit depth.
+func NewNYCbCrA16(r image.Rectangle, subsampleRatio image.YCbCrSubsampleRatio, bitDepth int) *NYCbCrA16 {
+	w, h, cw, ch := yCbCrSize(r, subsampleRatio)
+
+	i0 := 1*w*h + 0*cw*ch
+	i1 := 1*w*h + 1*cw*ch
+	i2 := 1*w*h + 2*cw*ch
+	i3 := 2*w*h + 2*cw*ch
+	b := make([]uint16, i3)
+	return &NYCbCrA16{
+		YCbCr16: YCbCr16{
+			Y:              b[:i0:i0],
+			Cb:             b[i0:i1:i1],
+			Cr:             b[i1:i2:i2],
+			SubsampleRatio: subsampleRatio,
+			YStride:        w,
+			CStride:        cw,
+			BitDepth:       bitDepth,
+			Rect:           r,
+		},
+		A:       b[i2:],
+		AStride: w,
+	}
+}
@@ -0,0 +1,55 @@
+package prores
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestYCbCr16(t *testing.T) {
+	img := NewYCbCr16(image.Rect(0, 0, 32, 16), image.YCbCrSubsampleRatio422, 10)
+	assert.Len(t, img.Y, 32*16)
+	assert.Len(t, img.Cb, 16*16)
+	assert.Equal(t, 17, img.COffset(3, 1))
+
+	img.Y[img.YOffset(5, 3)] = 0x3ff
+	img.Cb[img.COffset(5, 3)] = 0x200
+	img.Cr[img.COffset(5, 3)] = 0x200
+	assert.Equal(t, YCbCr16Color{0xffff, 0x801f, 0x801f}, img.At(5, 3))
+
+	sub := img.SubImage(image.Rect(4, 2, 12, 8)).(*YCbCr16)
+	assert.Equal(t, img.At(5, 3), sub.At(5, 3))
+	assert.Equal(t, YCbCr16Color{}, sub.At(0, 0))
+
+	r, g, b, a := img.At(5, 3).RGBA()
+	assert.True(t, r > 0xff00 && g > 0xff00 && b > 0xff00)
+	assert.EqualValues(t, 0xffff, a)
+}
+
+func TestNYCbCrA16(t *testing.T) {
+	img := NewNYCbCrA16(image.Rect(0, 0, 16, 16), image.YCbCrSubsampleRatio444, 12)
+	for i := range img.A {
+		img.A[i] = 0xfff
+	}
+	assert.True(t, img.Opaque())
+
+	img.A[img.AOffset(2, 2)] = 0
+	assert.False(t, img.Opaque())
+	assert.True(t, img.SubImage(image.Rect(4, 4, 8, 8)).(*NYCbCrA16).Opaque())
+
+	_, _, _, a := img.At(2, 2).RGBA()
+	assert.EqualValues(t, 0, a)
+}
+
+func TestYCbCr16Model(t *testing.T) {
+	c := YCbCr16Model.Convert(color.RGBA64{0xffff, 0xffff, 0xffff, 0xffff}).(YCbCr16Color)
+	assert.Equal(t, YCbCr16Color{0xffff, 0x8000, 0x8000}, c)
+
+	r, g, b, _ := color.YCbCr{0x80, 0x40, 0xc0}.RGBA()
+	r16, g16, b16, _ := YCbCr16Color{0x8080, 0x4040, 0xc0c0}.RGBA()
+	assert.InDelta(t, r, r16, 0x200)
+	assert.InDelta(t, g, g16, 0x200)
+	assert.InDelta(t, b, b16, 0x200)
+}